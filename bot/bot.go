@@ -0,0 +1,187 @@
+// Package bot implements bots that answer whatsat messages. Handlers register
+// for command prefixes or regular expressions and return the reply text, which
+// is sent back to the sender of the message.
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+// Message is an incoming message with a verified sender.
+type Message struct {
+	Sender    route.Vertex
+	Alias     string
+	Text      string
+	Timestamp time.Time
+	AmtMsat   int64
+}
+
+// Request is passed to a handler for a message that it matched.
+type Request struct {
+	*Message
+
+	// Args is the text after the command prefix, with surrounding white
+	// space removed. It is empty for regular expression handlers.
+	Args string
+
+	// Matches holds the text of the leftmost regular expression match and
+	// its submatches. It is nil for command handlers.
+	Matches []string
+}
+
+// HandlerFunc handles a request and returns the text to reply with. No reply is
+// sent when the text is empty.
+type HandlerFunc func(req *Request) (string, error)
+
+// Sender sends a reply to a node.
+type Sender interface {
+	Send(dest route.Vertex, text string) error
+}
+
+// Config configures a bot.
+type Config struct {
+	// Sender delivers the replies.
+	Sender Sender
+
+	// RateLimit is the maximum number of messages per sender that are
+	// handled within RateInterval. Messages over the limit are dropped.
+	// Zero disables rate limiting.
+	RateLimit int
+
+	// RateInterval is the interval that RateLimit applies to.
+	RateInterval time.Duration
+
+	// OnError is called when a handler or sending the reply fails. It may
+	// be nil.
+	OnError func(msg *Message, err error)
+}
+
+type handler struct {
+	prefix string
+	re     *regexp.Regexp
+	fn     HandlerFunc
+}
+
+// match returns the request for the message if the handler matches it.
+func (h *handler) match(msg *Message) *Request {
+	if h.re != nil {
+		matches := h.re.FindStringSubmatch(msg.Text)
+		if matches == nil {
+			return nil
+		}
+
+		return &Request{
+			Message: msg,
+			Matches: matches,
+		}
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	if !strings.HasPrefix(text, h.prefix) {
+		return nil
+	}
+
+	// Only match whole words, so that !info doesn't match !infos.
+	args := text[len(h.prefix):]
+	if args != "" && !strings.ContainsAny(args[:1], " \t\n") {
+		return nil
+	}
+
+	return &Request{
+		Message: msg,
+		Args:    strings.TrimSpace(args),
+	}
+}
+
+// Bot dispatches incoming messages to the registered handlers.
+type Bot struct {
+	cfg *Config
+
+	mtx      sync.Mutex
+	handlers []*handler
+	limiter  *rateLimiter
+}
+
+// New creates a bot without any handlers.
+func New(cfg *Config) *Bot {
+	return &Bot{
+		cfg:     cfg,
+		limiter: newRateLimiter(cfg.RateLimit, cfg.RateInterval),
+	}
+}
+
+// HandleCommand registers a handler for messages that start with the prefix,
+// for example "!status".
+func (b *Bot) HandleCommand(prefix string, fn HandlerFunc) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.handlers = append(b.handlers, &handler{
+		prefix: prefix,
+		fn:     fn,
+	})
+}
+
+// HandleRegexp registers a handler for messages that match the regular
+// expression.
+func (b *Bot) HandleRegexp(re *regexp.Regexp, fn HandlerFunc) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.handlers = append(b.handlers, &handler{
+		re: re,
+		fn: fn,
+	})
+}
+
+// Handle runs the first handler that matches the message and sends its reply.
+// Messages that no handler matches and messages over the rate limit of the
+// sender are ignored. It returns whether a handler ran.
+func (b *Bot) Handle(msg *Message) bool {
+	b.mtx.Lock()
+	var req *Request
+	var fn HandlerFunc
+	for _, h := range b.handlers {
+		if req = h.match(msg); req != nil {
+			fn = h.fn
+			break
+		}
+	}
+	b.mtx.Unlock()
+
+	if req == nil {
+		return false
+	}
+
+	if !b.limiter.allow(msg.Sender, time.Now()) {
+		b.fail(msg, fmt.Errorf("rate limit exceeded"))
+		return false
+	}
+
+	reply, err := fn(req)
+	if err != nil {
+		b.fail(msg, err)
+		return true
+	}
+	if reply == "" {
+		return true
+	}
+
+	if err := b.cfg.Sender.Send(msg.Sender, reply); err != nil {
+		b.fail(msg, err)
+	}
+
+	return true
+}
+
+func (b *Bot) fail(msg *Message, err error) {
+	if b.cfg.OnError != nil {
+		b.cfg.OnError(msg, err)
+	}
+}
@@ -0,0 +1,224 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+// reply is a reply sent by the test sender.
+type reply struct {
+	dest route.Vertex
+	text string
+}
+
+// testSender records the replies and fails if err is set.
+type testSender struct {
+	replies []reply
+	err     error
+}
+
+func (s *testSender) Send(dest route.Vertex, text string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.replies = append(s.replies, reply{dest, text})
+
+	return nil
+}
+
+// testBot returns a bot with a few handlers that reply with the name of the
+// handler and what they received.
+func testBot(cfg *Config) *Bot {
+	b := New(cfg)
+	b.HandleCommand("!echo", func(req *Request) (string, error) {
+		return "echo:" + req.Args, nil
+	})
+	b.HandleCommand("!silent", func(req *Request) (string, error) {
+		return "", nil
+	})
+	b.HandleCommand("!fail", func(req *Request) (string, error) {
+		return "", fmt.Errorf("failed")
+	})
+	b.HandleRegexp(regexp.MustCompile(`(\d+) sat`),
+		func(req *Request) (string, error) {
+			return fmt.Sprintf("regexp:%v", req.Matches), nil
+		},
+	)
+	b.HandleCommand("!shadowed", func(req *Request) (string, error) {
+		return "shadowed", nil
+	})
+
+	return b
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		handled bool
+		reply   string
+		err     string
+	}{
+		{
+			name:    "command",
+			text:    "!echo hello  world ",
+			handled: true,
+			reply:   "echo:hello  world",
+		},
+		{
+			name:    "command without args",
+			text:    "  !echo",
+			handled: true,
+			reply:   "echo:",
+		},
+		{
+			name:    "command on new line",
+			text:    "!echo\nnext",
+			handled: true,
+			reply:   "echo:next",
+		},
+		{
+			name: "prefix of a longer word",
+			text: "!echoes",
+		},
+		{
+			name: "command not at the start",
+			text: "say !echo",
+		},
+		{
+			name:    "empty reply",
+			text:    "!silent",
+			handled: true,
+		},
+		{
+			name:    "handler error",
+			text:    "!fail",
+			handled: true,
+			err:     "failed",
+		},
+		{
+			name:    "regexp",
+			text:    "send 100 sat please",
+			handled: true,
+			reply:   "regexp:[100 sat 100]",
+		},
+		{
+			// The first matching handler wins.
+			name:    "first match",
+			text:    "!shadowed 5 sat",
+			handled: true,
+			reply:   "regexp:[5 sat 5]",
+		},
+		{
+			name: "no match",
+			text: "hello",
+		},
+	}
+
+	sender := route.Vertex{1}
+	for _, test := range tests {
+		var errors []string
+		s := &testSender{}
+		b := testBot(&Config{
+			Sender: s,
+			OnError: func(msg *Message, err error) {
+				errors = append(errors, err.Error())
+			},
+		})
+
+		handled := b.Handle(&Message{
+			Sender:    sender,
+			Text:      test.text,
+			Timestamp: time.Now(),
+		})
+		if handled != test.handled {
+			t.Fatalf("%v: expected handled %v, got %v", test.name,
+				test.handled, handled)
+		}
+
+		var expected []reply
+		if test.reply != "" {
+			expected = []reply{{sender, test.reply}}
+		}
+		if !reflect.DeepEqual(s.replies, expected) {
+			t.Fatalf("%v: expected replies %v, got %v", test.name,
+				expected, s.replies)
+		}
+
+		var expectedErrors []string
+		if test.err != "" {
+			expectedErrors = []string{test.err}
+		}
+		if !reflect.DeepEqual(errors, expectedErrors) {
+			t.Fatalf("%v: expected errors %v, got %v", test.name,
+				expectedErrors, errors)
+		}
+	}
+}
+
+func TestHandleSendError(t *testing.T) {
+	var errors []error
+	s := &testSender{err: fmt.Errorf("no route")}
+	b := testBot(&Config{
+		Sender: s,
+		OnError: func(msg *Message, err error) {
+			errors = append(errors, err)
+		},
+	})
+
+	if !b.Handle(&Message{Sender: route.Vertex{1}, Text: "!echo"}) {
+		t.Fatal("message not handled")
+	}
+	if len(errors) != 1 || errors[0] != s.err {
+		t.Fatalf("expected send error, got %v", errors)
+	}
+}
+
+func TestHandleRateLimit(t *testing.T) {
+	var errors int
+	s := &testSender{}
+	b := testBot(&Config{
+		Sender:       s,
+		RateLimit:    2,
+		RateInterval: time.Hour,
+		OnError: func(msg *Message, err error) {
+			errors++
+		},
+	})
+
+	alice := route.Vertex{1}
+	bob := route.Vertex{2}
+	tests := []struct {
+		sender  route.Vertex
+		text    string
+		handled bool
+	}{
+		{alice, "!echo", true},
+		// Unmatched messages don't count towards the limit.
+		{alice, "hello", false},
+		{alice, "!silent", true},
+		{alice, "!echo", false},
+		{bob, "!echo", true},
+	}
+
+	for i, test := range tests {
+		handled := b.Handle(&Message{
+			Sender: test.sender,
+			Text:   test.text,
+		})
+		if handled != test.handled {
+			t.Fatalf("message %v: expected handled %v, got %v", i,
+				test.handled, handled)
+		}
+	}
+
+	if len(s.replies) != 2 || errors != 1 {
+		t.Fatalf("expected 2 replies and 1 error, got %v and %v",
+			len(s.replies), errors)
+	}
+}
@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+// rateLimiter limits the number of messages per sender within a sliding
+// window. Senders without messages in the window are forgotten, so that the
+// memory use doesn't grow with every sender that was ever seen.
+type rateLimiter struct {
+	limit    int
+	interval time.Duration
+
+	mtx  sync.Mutex
+	seen map[route.Vertex][]time.Time
+
+	// lastPrune is the time the idle senders were last removed.
+	lastPrune time.Time
+}
+
+func newRateLimiter(limit int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:    limit,
+		interval: interval,
+		seen:     make(map[route.Vertex][]time.Time),
+	}
+}
+
+// allow records a message from the sender at the given time and returns
+// whether it is within the limit.
+func (r *rateLimiter) allow(sender route.Vertex, now time.Time) bool {
+	if r.limit <= 0 {
+		return true
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.prune(now)
+
+	// Drop the messages that fell out of the window.
+	cutoff := now.Add(-r.interval)
+	recent := r.seen[sender][:0]
+	for _, t := range r.seen[sender] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+
+	if len(recent) >= r.limit {
+		r.seen[sender] = recent
+		return false
+	}
+
+	r.seen[sender] = append(recent, now)
+
+	return true
+}
+
+// prune removes the senders whose messages all fell out of the window. It runs
+// at most once per interval, so that the cost is spread over many messages.
+// The caller must hold the mutex.
+func (r *rateLimiter) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < r.interval {
+		return
+	}
+	r.lastPrune = now
+
+	cutoff := now.Add(-r.interval)
+	for sender, times := range r.seen {
+		if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+			delete(r.seen, sender)
+		}
+	}
+}
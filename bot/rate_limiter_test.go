@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+func TestRateLimiter(t *testing.T) {
+	alice := route.Vertex{1}
+	bob := route.Vertex{2}
+	start := time.Unix(1000, 0)
+
+	tests := []struct {
+		name     string
+		sender   route.Vertex
+		offset   time.Duration
+		expected bool
+	}{
+		{"first", alice, 0, true},
+		{"second", alice, time.Second, true},
+		{"over limit", alice, 2 * time.Second, false},
+		{"other sender", bob, 2 * time.Second, true},
+		{"still limited", alice, 59 * time.Second, false},
+		{"first expired", alice, 60 * time.Second, true},
+		{"limited again", alice, 60 * time.Second, false},
+		{"window passed", alice, 200 * time.Second, true},
+	}
+
+	r := newRateLimiter(2, time.Minute)
+	for _, test := range tests {
+		allowed := r.allow(test.sender, start.Add(test.offset))
+		if allowed != test.expected {
+			t.Fatalf("%v: expected %v, got %v", test.name,
+				test.expected, allowed)
+		}
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	r := newRateLimiter(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		if !r.allow(route.Vertex{1}, time.Now()) {
+			t.Fatal("message limited without a limit")
+		}
+	}
+	if len(r.seen) != 0 {
+		t.Fatalf("expected no senders, got %v", len(r.seen))
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	r := newRateLimiter(1, time.Minute)
+	start := time.Unix(1000, 0)
+
+	for i := 0; i < 100; i++ {
+		r.allow(route.Vertex{byte(i)}, start)
+	}
+	if len(r.seen) != 100 {
+		t.Fatalf("expected 100 senders, got %v", len(r.seen))
+	}
+
+	// Pruning waits for the interval to pass.
+	r.allow(route.Vertex{200}, start.Add(40*time.Second))
+	if len(r.seen) != 101 {
+		t.Fatalf("expected 101 senders, got %v", len(r.seen))
+	}
+
+	// Senders that are still within the window are kept.
+	r.allow(route.Vertex{201}, start.Add(90*time.Second))
+	if len(r.seen) != 2 {
+		t.Fatalf("expected 2 senders, got %v", len(r.seen))
+	}
+	if _, ok := r.seen[route.Vertex{200}]; !ok {
+		t.Fatal("active sender removed")
+	}
+
+	r.allow(route.Vertex{201}, start.Add(3*time.Minute))
+	if len(r.seen) != 1 {
+		t.Fatalf("expected 1 sender, got %v", len(r.seen))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+const chatAddressScheme = "whatsat"
+
+// chatAddress is a shareable address of a chat node. Besides the node's public
+// key, it carries route hints so that nodes that only have private channels
+// can still be reached.
+//
+// The string encoding is:
+//
+//	whatsat:<pubkey>?hint=<node>:<chan_id>:<base_fee_msat>:<fee_ppm>:<cltv_delta>&hint=...
+type chatAddress struct {
+	pubKey     route.Vertex
+	routeHints []*lnrpc.RouteHint
+}
+
+// String encodes the chat address.
+func (a *chatAddress) String() string {
+	addr := chatAddressScheme + ":" + a.pubKey.String()
+
+	var hints []string
+	for _, routeHint := range a.routeHints {
+		for _, h := range routeHint.HopHints {
+			hints = append(hints, "hint="+fmt.Sprintf(
+				"%v:%v:%v:%v:%v", h.NodeId, h.ChanId,
+				h.FeeBaseMsat, h.FeeProportionalMillionths,
+				h.CltvExpiryDelta,
+			))
+		}
+	}
+	if len(hints) > 0 {
+		addr += "?" + strings.Join(hints, "&")
+	}
+
+	return addr
+}
+
+// parseChatAddress decodes a chat address. Each hint is turned into a route
+// hint with a single hop.
+func parseChatAddress(addr string) (*chatAddress, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != chatAddressScheme {
+		return nil, fmt.Errorf("not a chat address: %v", addr)
+	}
+
+	pubKey, err := route.NewVertexFromStr(u.Opaque)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &chatAddress{
+		pubKey: pubKey,
+	}
+
+	for _, hint := range u.Query()["hint"] {
+		fields := strings.Split(hint, ":")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid hint: %v", hint)
+		}
+
+		if _, err := route.NewVertexFromStr(fields[0]); err != nil {
+			return nil, fmt.Errorf("invalid hint node: %v", err)
+		}
+
+		var values [4]uint64
+		for i, field := range fields[1:] {
+			values[i], err = strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hint: %v", hint)
+			}
+		}
+
+		a.routeHints = append(a.routeHints, &lnrpc.RouteHint{
+			HopHints: []*lnrpc.HopHint{
+				{
+					NodeId:                    fields[0],
+					ChanId:                    values[0],
+					FeeBaseMsat:               uint32(values[1]),
+					FeeProportionalMillionths: uint32(values[2]),
+					CltvExpiryDelta:           uint32(values[3]),
+				},
+			},
+		})
+	}
+
+	return a, nil
+}
+
+// getChatAddress builds the chat address of our own node. A hint is added for
+// every active private channel, using the forwarding policy of the peer
+// towards us.
+func getChatAddress(client lnrpc.LightningClient) (*chatAddress, error) {
+	ctxb := context.Background()
+
+	info, err := client.GetInfo(ctxb, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, err := route.NewVertexFromStr(info.IdentityPubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := client.ListChannels(ctxb, &lnrpc.ListChannelsRequest{
+		ActiveOnly:  true,
+		PrivateOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a := &chatAddress{
+		pubKey: pubKey,
+	}
+
+	for _, channel := range channels.Channels {
+		edge, err := client.GetChanInfo(ctxb, &lnrpc.ChanInfoRequest{
+			ChanId: channel.ChanId,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var policy *lnrpc.RoutingPolicy
+		switch channel.RemotePubkey {
+		case edge.Node1Pub:
+			policy = edge.Node1Policy
+		case edge.Node2Pub:
+			policy = edge.Node2Policy
+		}
+
+		// Without a policy of the peer, we can't tell senders what
+		// the last hop is going to charge.
+		if policy == nil {
+			continue
+		}
+
+		a.routeHints = append(a.routeHints, &lnrpc.RouteHint{
+			HopHints: []*lnrpc.HopHint{
+				{
+					NodeId:                    channel.RemotePubkey,
+					ChanId:                    channel.ChanId,
+					FeeBaseMsat:               uint32(policy.FeeBaseMsat),
+					FeeProportionalMillionths: uint32(policy.FeeRateMilliMsat),
+					CltvExpiryDelta:           policy.TimeLockDelta,
+				},
+			},
+		})
+	}
+
+	return a, nil
+}
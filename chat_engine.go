@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/keychain"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/signrpc"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/lightningnetwork/lnd/routing/route"
+	"google.golang.org/grpc"
+)
+
+var byteOrder = binary.BigEndian
+
+var (
+	// routeHints holds the route hints for destinations that were set
+	// through a chat address.
+	routeHints    = make(map[route.Vertex][]*lnrpc.RouteHint)
+	routeHintsMtx sync.RWMutex
+)
+
+func getRouteHints(dest route.Vertex) []*lnrpc.RouteHint {
+	routeHintsMtx.RLock()
+	defer routeHintsMtx.RUnlock()
+
+	return routeHints[dest]
+}
+
+const (
+	tlvMsgRecord    = 34349334
+	tlvSigRecord    = 34349337
+	tlvSenderRecord = 34349339
+	tlvTimeRecord   = 34349343
+
+	// TODO: Reference lnd master constant when available.
+	tlvKeySendRecord = 5482373484
+)
+
+type messageState uint8
+
+const (
+	statePending messageState = iota
+
+	stateDelivered
+
+	stateFailed
+)
+
+func (s messageState) String() string {
+	switch s {
+	case statePending:
+		return "pending"
+	case stateDelivered:
+		return "delivered"
+	default:
+		return "failed"
+	}
+}
+
+// deliveryUpdate reports the progress of sending a message.
+type deliveryUpdate struct {
+	state messageState
+
+	// fee is the routing fee in msat that was paid for a delivered
+	// message.
+	fee int64
+
+	// route is the route that delivered the message.
+	route *lnrpc.Route
+
+	// attempts is the number of htlc attempts made so far.
+	attempts int
+
+	// deliveryTime is the time it took from starting the payment until
+	// its final outcome was known.
+	deliveryTime time.Duration
+
+	// err is set when the payment couldn't be started.
+	err error
+}
+
+// receivedMessage is an incoming message with a verified signature.
+type receivedMessage struct {
+	sender    route.Vertex
+	text      string
+	timestamp time.Time
+	amtMsat   int64
+}
+
+// chatEngine sends and receives whatsat messages through lnd and keeps track
+// of the running balance with each contact. It is shared by the interactive
+// chat and the other front ends.
+type chatEngine struct {
+	mainRpc lnrpc.LightningClient
+	router  routerrpc.RouterClient
+	signer  signrpc.SignerClient
+
+	// chatMsgAmt is the amount that is paid with each message when there
+	// is no balance to pay back.
+	chatMsgAmt int64
+
+	balanceMtx     sync.Mutex
+	runningBalance map[route.Vertex]int64
+}
+
+// newChatEngine creates a chat engine on an lnd connection. It initializes the
+// alias maps and our own key.
+func newChatEngine(conn *grpc.ClientConn, chatMsgAmt int64) (*chatEngine,
+	error) {
+
+	if err := initAliasMaps(conn); err != nil {
+		return nil, err
+	}
+
+	return &chatEngine{
+		mainRpc:        lnrpc.NewLightningClient(conn),
+		router:         routerrpc.NewRouterClient(conn),
+		signer:         signrpc.NewSignerClient(conn),
+		chatMsgAmt:     chatMsgAmt,
+		runningBalance: make(map[route.Vertex]int64),
+	}, nil
+}
+
+// balance returns what we owe the contact in msat. A negative balance means
+// that the contact owes us.
+func (e *chatEngine) balance(contact route.Vertex) int64 {
+	e.balanceMtx.Lock()
+	defer e.balanceMtx.Unlock()
+
+	return e.runningBalance[contact]
+}
+
+func (e *chatEngine) addBalance(contact route.Vertex, amt int64) {
+	e.balanceMtx.Lock()
+	defer e.balanceMtx.Unlock()
+
+	e.runningBalance[contact] += amt
+}
+
+// payAmt returns the amount to pay to the destination with the next message.
+// The running balance is paid back, bounded by the chat amount.
+func (e *chatEngine) payAmt(dest route.Vertex) int64 {
+	payAmt := e.balance(dest)
+	if payAmt < e.chatMsgAmt {
+		payAmt = e.chatMsgAmt
+	}
+	if payAmt > 10*e.chatMsgAmt {
+		payAmt = 10 * e.chatMsgAmt
+	}
+
+	return payAmt
+}
+
+// feeLimit returns the maximum routing fee to pay for a message.
+func (e *chatEngine) feeLimit() int64 {
+	return e.chatMsgAmt * 10
+}
+
+// estimate queries a route for the next message to the destination.
+func (e *chatEngine) estimate(dest route.Vertex) *routeEstimate {
+	return estimateRoute(e.mainRpc, dest, e.payAmt(dest), e.feeLimit())
+}
+
+// send passes the message through the before_send hooks and delivers it. Hooks
+// may change the text or veto the message, in which case errVetoed is
+// returned.
+func (e *chatEngine) send(dest route.Vertex, text string,
+	update func(*deliveryUpdate)) error {
+
+	text, err := e.beforeSend(dest, text)
+	if err != nil {
+		return err
+	}
+
+	return e.deliver(dest, text, update)
+}
+
+// beforeSend runs the before_send hooks on an outgoing message and returns the
+// text that is to be sent. Front ends that show the message before it is
+// delivered use it together with deliver, so that they show the text that is
+// actually sent.
+func (e *chatEngine) beforeSend(dest route.Vertex, text string) (string,
+	error) {
+
+	if hooks == nil {
+		return text, nil
+	}
+
+	return hooks.beforeSend(dest, text, e.payAmt(dest))
+}
+
+// deliver signs a message that already passed the before_send hooks and starts
+// paying it to the destination. The progress of the payment is reported to the
+// update callback from a separate goroutine, until the message is delivered or
+// failed.
+func (e *chatEngine) deliver(dest route.Vertex, text string,
+	update func(*deliveryUpdate)) error {
+
+	payAmt := e.payAmt(dest)
+
+	if hooks != nil {
+		update = e.hookUpdates(hooks, dest, text, payAmt, update)
+	}
+
+	var preimage lntypes.Preimage
+	if _, err := rand.Read(preimage[:]); err != nil {
+		return err
+	}
+	hash := preimage.Hash()
+
+	// Message sending time stamp
+	timestamp := time.Now().UnixNano()
+	var timeBuffer [8]byte
+	byteOrder.PutUint64(timeBuffer[:], uint64(timestamp))
+
+	// Sign all data.
+	signData, err := getSignData(self, dest, timeBuffer[:], []byte(text))
+	if err != nil {
+		return err
+	}
+
+	signResp, err := e.signer.SignMessage(
+		context.Background(), &signrpc.SignMessageReq{
+			Msg: signData,
+			KeyLoc: &signrpc.KeyLocator{
+				KeyFamily: int32(keychain.KeyFamilyNodeKey),
+				KeyIndex:  0,
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	signature := signResp.Signature
+
+	customRecords := map[uint64][]byte{
+		tlvMsgRecord:     []byte(text),
+		tlvSenderRecord:  self[:],
+		tlvTimeRecord:    timeBuffer[:],
+		tlvSigRecord:     signature,
+		tlvKeySendRecord: preimage[:],
+	}
+
+	req := routerrpc.SendPaymentRequest{
+		PaymentHash:       hash[:],
+		AmtMsat:           payAmt,
+		FinalCltvDelta:    40,
+		Dest:              dest[:],
+		FeeLimitMsat:      e.feeLimit(),
+		TimeoutSeconds:    30,
+		DestCustomRecords: customRecords,
+		RouteHints:        getRouteHints(dest),
+	}
+	getPolicy(dest).apply(&req)
+
+	go func() {
+		start := time.Now()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := e.router.SendPayment(ctx, &req)
+		if err != nil {
+			update(&deliveryUpdate{
+				state: stateFailed,
+				err:   err,
+			})
+			return
+		}
+
+		for {
+			status, err := stream.Recv()
+			if err != nil {
+				update(&deliveryUpdate{
+					state:        stateFailed,
+					deliveryTime: time.Since(start),
+					err:          err,
+				})
+				return
+			}
+
+			u := &deliveryUpdate{
+				state:    statePending,
+				attempts: len(status.Htlcs),
+			}
+
+			switch status.State {
+			case routerrpc.PaymentState_SUCCEEDED:
+				e.addBalance(dest, -payAmt)
+
+				u.state = stateDelivered
+				u.fee = status.Route.TotalFeesMsat
+				u.route = status.Route
+				u.deliveryTime = time.Since(start)
+
+			case routerrpc.PaymentState_IN_FLIGHT:
+
+			default:
+				u.state = stateFailed
+				u.deliveryTime = time.Since(start)
+			}
+
+			update(u)
+
+			if u.state != statePending {
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// hookUpdates wraps the update callback to run the delivery hooks when the
+// message reached its final state.
+func (e *chatEngine) hookUpdates(h *scriptHooks, dest route.Vertex,
+	text string, payAmt int64,
+	update func(*deliveryUpdate)) func(*deliveryUpdate) {
+
+	return func(u *deliveryUpdate) {
+		update(u)
+
+		if u.state != statePending {
+			h.delivered(dest, text, payAmt, u)
+		}
+	}
+}
+
+// receive subscribes to settled invoices and calls the handler for every
+// incoming message with a valid signature. Replies of the receive hooks are
+// sent back to the sender through the reply function, so that the front end
+// can show them like its own messages. If reply is nil, they are sent without
+// being shown. It blocks until the subscription fails or the context is
+// canceled.
+func (e *chatEngine) receive(ctx context.Context,
+	handler func(*receivedMessage),
+	reply func(route.Vertex, string) error) error {
+
+	stream, err := e.mainRpc.SubscribeInvoices(
+		ctx, &lnrpc.InvoiceSubscription{},
+	)
+	if err != nil {
+		return err
+	}
+
+	for {
+		invoice, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		msg, err := e.decodeMessage(invoice)
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			continue
+		}
+
+		e.addBalance(msg.sender, msg.amtMsat)
+
+		handler(msg)
+
+		if hooks != nil {
+			for _, text := range hooks.received(msg) {
+				e.sendReply(msg.sender, text, reply)
+			}
+		}
+	}
+}
+
+// sendReply sends a reply of a hook through the reply function, or directly if
+// there is none. Failures are only logged, because there is nobody waiting for
+// the outcome.
+func (e *chatEngine) sendReply(dest route.Vertex, text string,
+	reply func(route.Vertex, string) error) {
+
+	if reply == nil {
+		reply = func(dest route.Vertex, text string) error {
+			return e.send(dest, text, func(*deliveryUpdate) {})
+		}
+	}
+
+	if err := reply(dest, text); err != nil {
+		hooks.logger.Printf("Cannot send reply to %v: %v", dest, err)
+	}
+}
+
+// decodeMessage extracts the message from a settled invoice and verifies its
+// signature. Nil is returned for invoices that don't carry a valid message.
+func (e *chatEngine) decodeMessage(
+	invoice *lnrpc.Invoice) (*receivedMessage, error) {
+
+	if invoice.State != lnrpc.Invoice_SETTLED {
+		return nil, nil
+	}
+
+	var customRecords map[uint64][]byte
+	for _, htlc := range invoice.Htlcs {
+		if htlc.State == lnrpc.InvoiceHTLCState_SETTLED {
+			customRecords = htlc.CustomRecords
+			break
+		}
+	}
+	if customRecords == nil {
+		return nil, nil
+	}
+
+	msg, ok := customRecords[tlvMsgRecord]
+	if !ok {
+		return nil, nil
+	}
+
+	signature, ok := customRecords[tlvSigRecord]
+	if !ok {
+		return nil, nil
+	}
+
+	timestampBytes, ok := customRecords[tlvTimeRecord]
+	if !ok || len(timestampBytes) != 8 {
+		return nil, nil
+	}
+	timestamp := time.Unix(
+		0,
+		int64(byteOrder.Uint64(timestampBytes)),
+	)
+
+	senderBytes, ok := customRecords[tlvSenderRecord]
+	if !ok {
+		return nil, nil
+	}
+	sender, err := route.NewVertexFromBytes(senderBytes)
+	if err != nil {
+		// Invalid sender pubkey
+		return nil, nil
+	}
+
+	signData, err := getSignData(sender, self, timestampBytes, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	verifyResp, err := e.signer.VerifyMessage(
+		context.Background(),
+		&signrpc.VerifyMessageReq{
+			Msg:       signData,
+			Signature: signature,
+			Pubkey:    sender[:],
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if !verifyResp.Valid {
+		return nil, nil
+	}
+
+	return &receivedMessage{
+		sender:    sender,
+		text:      string(msg),
+		timestamp: timestamp,
+		amtMsat:   invoice.AmtPaidMsat,
+	}, nil
+}
+
+// resolveDest parses a destination that is either a chat address, a pubkey or
+// an alias. Route hints of a chat address are remembered for sending.
+func resolveDest(destStr string) (route.Vertex, error) {
+	if addr, err := parseChatAddress(destStr); err == nil {
+		routeHintsMtx.Lock()
+		routeHints[addr.pubKey] = addr.routeHints
+		routeHintsMtx.Unlock()
+
+		return addr.pubKey, nil
+	}
+
+	if dest, ok := aliasToKey[destStr]; ok {
+		return dest, nil
+	}
+
+	dest, err := route.NewVertexFromStr(destStr)
+	if err != nil {
+		return route.Vertex{}, fmt.Errorf("unknown destination: %v",
+			destStr)
+	}
+
+	return dest, nil
+}
+
+func getSignData(sender, recipient route.Vertex, timestamp []byte, msg []byte) ([]byte, error) {
+	var signData bytes.Buffer
+
+	// Write sender.
+	if _, err := signData.Write(sender[:]); err != nil {
+		return nil, err
+	}
+
+	// Write recipient.
+	if _, err := signData.Write(recipient[:]); err != nil {
+		return nil, err
+	}
+
+	// Write time.
+	if _, err := signData.Write(timestamp); err != nil {
+		return nil, err
+	}
+
+	// Write message.
+	if _, err := signData.Write(msg); err != nil {
+		return nil, err
+	}
+
+	return signData.Bytes(), nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"container/heap"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// graphEdge is one direction of a channel. The policy is the policy of the
+// from node, which determines what it charges to forward over the channel.
+type graphEdge struct {
+	from     string
+	to       string
+	policy   *lnrpc.RoutingPolicy
+	capacity int64
+}
+
+// chatGraph is an in-memory copy of the channel graph that can be extended
+// with hypothetical channels to find the cheapest routes for chat payments.
+type chatGraph struct {
+	// incoming holds the edges that lead into each node.
+	incoming map[string][]*graphEdge
+}
+
+// newChatGraph builds a chat graph from the graph returned by lnd.
+func newChatGraph(graph *lnrpc.ChannelGraph) *chatGraph {
+	g := &chatGraph{
+		incoming: make(map[string][]*graphEdge),
+	}
+
+	for _, e := range graph.Edges {
+		g.addChannel(
+			e.Node1Pub, e.Node2Pub, e.Node1Policy, e.Node2Policy,
+			e.Capacity,
+		)
+	}
+
+	return g
+}
+
+// addChannel adds a channel between node1 and node2 to the graph. A nil policy
+// means that the channel can't be used in that direction.
+func (g *chatGraph) addChannel(node1, node2 string, policy1,
+	policy2 *lnrpc.RoutingPolicy, capacity int64) {
+
+	g.incoming[node2] = append(g.incoming[node2], &graphEdge{
+		from:     node1,
+		to:       node2,
+		policy:   policy1,
+		capacity: capacity,
+	})
+	g.incoming[node1] = append(g.incoming[node1], &graphEdge{
+		from:     node2,
+		to:       node1,
+		policy:   policy2,
+		capacity: capacity,
+	})
+}
+
+// graphRoute describes the cheapest route that was found to a target.
+type graphRoute struct {
+	fee  int64
+	hops int
+}
+
+// cheapestRoute finds the route from source to target with the lowest fee for
+// delivering the amount. The search runs backwards from the target, so that
+// the amount that each node needs to forward is known when its fee is
+// calculated. The source doesn't charge itself a fee for the first hop. Nil is
+// returned if there is no route.
+func (g *chatGraph) cheapestRoute(source, target string,
+	amtMsat int64) *graphRoute {
+
+	type nodeDist struct {
+		amt  int64
+		hops int
+	}
+
+	dist := map[string]*nodeDist{
+		target: {amt: amtMsat},
+	}
+	done := make(map[string]bool)
+
+	queue := &distHeap{}
+	heap.Push(queue, &distItem{node: target, amt: amtMsat})
+
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(*distItem)
+		if done[item.node] {
+			continue
+		}
+		done[item.node] = true
+
+		if item.node == source {
+			d := dist[source]
+			return &graphRoute{
+				fee:  d.amt - amtMsat,
+				hops: d.hops,
+			}
+		}
+
+		toDist := dist[item.node]
+		for _, e := range g.incoming[item.node] {
+			if done[e.from] {
+				continue
+			}
+
+			if e.capacity > 0 && toDist.amt > e.capacity*1000 {
+				continue
+			}
+
+			amt := toDist.amt
+			if e.from != source {
+				if !policyForwards(e.policy, amt) {
+					continue
+				}
+				amt += policyFee(e.policy, amt)
+			}
+
+			d, ok := dist[e.from]
+			if ok && d.amt <= amt {
+				continue
+			}
+
+			dist[e.from] = &nodeDist{
+				amt:  amt,
+				hops: toDist.hops + 1,
+			}
+			heap.Push(queue, &distItem{node: e.from, amt: amt})
+		}
+	}
+
+	return nil
+}
+
+type distItem struct {
+	node string
+	amt  int64
+}
+
+// distHeap is a min-heap of nodes ordered by the amount they need to send.
+type distHeap []*distItem
+
+func (h distHeap) Len() int            { return len(h) }
+func (h distHeap) Less(i, j int) bool  { return h[i].amt < h[j].amt }
+func (h distHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *distHeap) Push(x interface{}) { *h = append(*h, x.(*distItem)) }
+
+func (h *distHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// testRouteGraph returns a graph with two routes from self to target:
+//
+//	self -- alice -- bob -- target
+//	  |                       |
+//	  +------- carol ---------+
+//
+// The route through alice and bob charges 220 msat for 1000 msat. Carol only
+// charges 1 msat, so tests change her policy to see when her route is used.
+func testRouteGraph(carol *lnrpc.RoutingPolicy) *lnrpc.ChannelGraph {
+	policy := func(base, rate int64) *lnrpc.RoutingPolicy {
+		return &lnrpc.RoutingPolicy{
+			FeeBaseMsat:      base,
+			FeeRateMilliMsat: rate,
+		}
+	}
+
+	return &lnrpc.ChannelGraph{
+		Edges: []*lnrpc.ChannelEdge{
+			{
+				// Our own fee isn't charged for the first hop.
+				Node1Pub:    "self",
+				Node2Pub:    "alice",
+				Capacity:    100000,
+				Node1Policy: policy(5000, 0),
+				Node2Policy: policy(0, 0),
+			},
+			{
+				Node1Pub:    "alice",
+				Node2Pub:    "bob",
+				Capacity:    100000,
+				Node1Policy: policy(10, 100000),
+				Node2Policy: policy(0, 0),
+			},
+			{
+				Node1Pub:    "target",
+				Node2Pub:    "bob",
+				Capacity:    100000,
+				Node1Policy: policy(0, 0),
+				Node2Policy: policy(100, 0),
+			},
+			{
+				Node1Pub:    "self",
+				Node2Pub:    "carol",
+				Capacity:    100000,
+				Node1Policy: policy(0, 0),
+				Node2Policy: policy(0, 0),
+			},
+			{
+				Node1Pub:    "carol",
+				Node2Pub:    "target",
+				Capacity:    100000,
+				Node1Policy: carol,
+				Node2Policy: policy(0, 0),
+			},
+		},
+	}
+}
+
+func TestCheapestRoute(t *testing.T) {
+	// The route through alice and bob: bob charges 100 msat to forward
+	// 1000 msat, alice 10 msat plus 10% of the 1100 msat she forwards.
+	expensive := &graphRoute{fee: 220, hops: 3}
+
+	tests := []struct {
+		name     string
+		carol    *lnrpc.RoutingPolicy
+		amtMsat  int64
+		expected *graphRoute
+	}{
+		{
+			name:     "cheapest",
+			carol:    &lnrpc.RoutingPolicy{FeeBaseMsat: 1},
+			amtMsat:  1000,
+			expected: &graphRoute{fee: 1, hops: 2},
+		},
+		{
+			name:     "no policy",
+			carol:    nil,
+			amtMsat:  1000,
+			expected: expensive,
+		},
+		{
+			name: "disabled",
+			carol: &lnrpc.RoutingPolicy{
+				FeeBaseMsat: 1,
+				Disabled:    true,
+			},
+			amtMsat:  1000,
+			expected: expensive,
+		},
+		{
+			name: "below min htlc",
+			carol: &lnrpc.RoutingPolicy{
+				FeeBaseMsat: 1,
+				MinHtlc:     1001,
+			},
+			amtMsat:  1000,
+			expected: expensive,
+		},
+		{
+			name: "above max htlc",
+			carol: &lnrpc.RoutingPolicy{
+				FeeBaseMsat: 1,
+				MaxHtlcMsat: 999,
+			},
+			amtMsat:  1000,
+			expected: expensive,
+		},
+		{
+			name: "within htlc limits",
+			carol: &lnrpc.RoutingPolicy{
+				FeeBaseMsat: 1,
+				MinHtlc:     1000,
+				MaxHtlcMsat: 1000,
+			},
+			amtMsat:  1000,
+			expected: &graphRoute{fee: 1, hops: 2},
+		},
+		{
+			name: "fee rate",
+			carol: &lnrpc.RoutingPolicy{
+				FeeRateMilliMsat: 300000,
+			},
+			amtMsat:  1000,
+			expected: expensive,
+		},
+		{
+			// Alice's fee rate outweighs carol's base fee for
+			// larger amounts.
+			name: "larger amount",
+			carol: &lnrpc.RoutingPolicy{
+				FeeBaseMsat: 1000,
+			},
+			amtMsat:  100000,
+			expected: &graphRoute{fee: 1000, hops: 2},
+		},
+		{
+			name:     "above capacity",
+			carol:    &lnrpc.RoutingPolicy{},
+			amtMsat:  100000001,
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		g := newChatGraph(testRouteGraph(test.carol))
+		r := g.cheapestRoute("self", "target", test.amtMsat)
+		if !reflect.DeepEqual(r, test.expected) {
+			t.Errorf("%v: expected %+v, got %+v", test.name,
+				test.expected, r)
+		}
+	}
+}
+
+func TestCheapestRouteUnreachable(t *testing.T) {
+	g := newChatGraph(testRouteGraph(nil))
+
+	if r := g.cheapestRoute("self", "dave", 1000); r != nil {
+		t.Fatalf("expected no route, got %+v", r)
+	}
+
+	// Bob doesn't forward over a channel without his policy.
+	g.addChannel("bob", "dave", nil, &lnrpc.RoutingPolicy{}, 100000)
+	if r := g.cheapestRoute("self", "dave", 1000); r != nil {
+		t.Fatalf("expected no route, got %+v", r)
+	}
+}
+
+func TestSimulateChannel(t *testing.T) {
+	graph := testRouteGraph(nil)
+
+	results := simulateChannel(
+		graph, "self", "bob", 100000, 1000,
+		[]string{"target", "bob", "dave"},
+	)
+
+	expected := []simulatedTarget{
+		{
+			// Only bob's fee is left with a direct channel to
+			// him.
+			Target:      "target",
+			Reachable:   true,
+			FeeMsat:     220,
+			Hops:        3,
+			NewFeeMsat:  100,
+			NewHops:     2,
+			Improvement: 120,
+		},
+		{
+			Target:      "bob",
+			Reachable:   true,
+			FeeMsat:     110,
+			Hops:        2,
+			NewFeeMsat:  0,
+			NewHops:     1,
+			Improvement: 110,
+		},
+		{
+			Target: "dave",
+		},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, results)
+	}
+
+	// A channel to a peer without other channels only helps to reach the
+	// peer itself.
+	results = simulateChannel(
+		graph, "self", "dave", 100000, 1000, []string{"dave", "target"},
+	)
+	expected = []simulatedTarget{
+		{
+			Target:     "dave",
+			Reachable:  true,
+			NewFeeMsat: 0,
+			NewHops:    1,
+		},
+		{
+			Target:      "target",
+			Reachable:   true,
+			FeeMsat:     220,
+			Hops:        3,
+			NewFeeMsat:  220,
+			NewHops:     3,
+			Improvement: 0,
+		},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, results)
+	}
+}
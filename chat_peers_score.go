@@ -0,0 +1,189 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// peerScore describes how suitable a node is as a peer for chat traffic.
+type peerScore struct {
+	node  string
+	alias string
+
+	// fee is the lowest fee in msat that the node charges to forward the
+	// chat amount over any of its channels that accept that amount. It is
+	// only meaningful if compatible is true.
+	fee int64
+
+	// minHtlc is the lowest min_htlc in msat across the node's channels.
+	minHtlc int64
+
+	// compatible indicates whether at least one channel of the node
+	// forwards the chat amount.
+	compatible bool
+
+	// channels is the number of channels of the node.
+	channels int
+
+	// capacity is the total capacity in sat of the node's channels.
+	capacity int64
+
+	// reachable indicates whether the node can be reached from our node
+	// through channels that have an enabled policy.
+	reachable bool
+}
+
+// policyFee returns the fee in msat that a routing policy charges to forward
+// the amount.
+func policyFee(p *lnrpc.RoutingPolicy, amtMsat int64) int64 {
+	return p.FeeBaseMsat + amtMsat*p.FeeRateMilliMsat/1000000
+}
+
+// policyForwards returns whether a routing policy allows forwarding the amount.
+func policyForwards(p *lnrpc.RoutingPolicy, amtMsat int64) bool {
+	if p == nil || p.Disabled {
+		return false
+	}
+
+	if amtMsat < p.MinHtlc {
+		return false
+	}
+
+	return p.MaxHtlcMsat == 0 || uint64(amtMsat) <= p.MaxHtlcMsat
+}
+
+// scorePeers computes the peer score of every node in the graph for chat
+// payments of the given amount. The policy of a node's side of a channel
+// determines what the node charges to forward over that channel.
+func scorePeers(graph *lnrpc.ChannelGraph, self string,
+	amtMsat int64) map[string]*peerScore {
+
+	scores := make(map[string]*peerScore)
+	for _, node := range graph.Nodes {
+		scores[node.PubKey] = &peerScore{
+			node:    node.PubKey,
+			alias:   node.Alias,
+			minHtlc: -1,
+		}
+	}
+
+	getScore := func(key string) *peerScore {
+		s, ok := scores[key]
+		if !ok {
+			s = &peerScore{
+				node:    key,
+				minHtlc: -1,
+			}
+			scores[key] = s
+		}
+		return s
+	}
+
+	process := func(key string, p *lnrpc.RoutingPolicy, capacity int64) {
+		s := getScore(key)
+		s.channels++
+		s.capacity += capacity
+
+		if p == nil {
+			return
+		}
+
+		if s.minHtlc < 0 || p.MinHtlc < s.minHtlc {
+			s.minHtlc = p.MinHtlc
+		}
+
+		if !policyForwards(p, amtMsat) {
+			return
+		}
+
+		fee := policyFee(p, amtMsat)
+		if !s.compatible || fee < s.fee {
+			s.fee = fee
+		}
+		s.compatible = true
+	}
+
+	for _, e := range graph.Edges {
+		process(e.Node1Pub, e.Node1Policy, e.Capacity)
+		process(e.Node2Pub, e.Node2Policy, e.Capacity)
+	}
+
+	for key := range reachableNodes(graph, self) {
+		getScore(key).reachable = true
+	}
+
+	for _, s := range scores {
+		if s.minHtlc < 0 {
+			s.minHtlc = 0
+		}
+	}
+
+	return scores
+}
+
+// reachableNodes returns the set of nodes that can be reached from the source
+// node. A channel can only be used in the direction of a node that has an
+// enabled policy for it.
+func reachableNodes(graph *lnrpc.ChannelGraph,
+	source string) map[string]struct{} {
+
+	adjacent := make(map[string][]string)
+	for _, e := range graph.Edges {
+		if e.Node1Policy != nil && !e.Node1Policy.Disabled {
+			adjacent[e.Node1Pub] = append(
+				adjacent[e.Node1Pub], e.Node2Pub,
+			)
+		}
+		if e.Node2Policy != nil && !e.Node2Policy.Disabled {
+			adjacent[e.Node2Pub] = append(
+				adjacent[e.Node2Pub], e.Node1Pub,
+			)
+		}
+	}
+
+	reached := map[string]struct{}{
+		source: {},
+	}
+	queue := []string{source}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		for _, next := range adjacent[node] {
+			if _, ok := reached[next]; ok {
+				continue
+			}
+			reached[next] = struct{}{}
+			queue = append(queue, next)
+		}
+	}
+
+	return reached
+}
+
+// rankPeers sorts peer scores from most to least suitable. Nodes that forward
+// the chat amount come first, ordered by fee. Ties are broken by the number of
+// channels and then by capacity.
+func rankPeers(list []*peerScore) {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+
+		if a.compatible != b.compatible {
+			return a.compatible
+		}
+		if a.fee != b.fee {
+			return a.fee < b.fee
+		}
+		if a.reachable != b.reachable {
+			return a.reachable
+		}
+		if a.channels != b.channels {
+			return a.channels > b.channels
+		}
+		if a.capacity != b.capacity {
+			return a.capacity > b.capacity
+		}
+		return a.node < b.node
+	})
+}
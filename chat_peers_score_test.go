@@ -0,0 +1,228 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// testGraph returns a fixture graph around our node "self":
+//
+//	self -- alice -- bob -- erin
+//	          |
+//	        carol      dave -- frank
+//
+// Alice charges different fees on her channels, carol's min_htlc is too high
+// for the chat amount, bob has disabled his side of the channel with erin and
+// dave and frank aren't connected to us.
+func testGraph() *lnrpc.ChannelGraph {
+	policy := func(base, rate, minHtlc int64) *lnrpc.RoutingPolicy {
+		return &lnrpc.RoutingPolicy{
+			FeeBaseMsat:      base,
+			FeeRateMilliMsat: rate,
+			MinHtlc:          minHtlc,
+		}
+	}
+
+	return &lnrpc.ChannelGraph{
+		Nodes: []*lnrpc.LightningNode{
+			{PubKey: "self", Alias: "Self"},
+			{PubKey: "alice", Alias: "Alice"},
+			{PubKey: "bob", Alias: "Bob"},
+			{PubKey: "carol", Alias: "Carol"},
+			{PubKey: "dave", Alias: "Dave"},
+			{PubKey: "erin", Alias: "Erin"},
+			{PubKey: "frank", Alias: "Frank"},
+		},
+		Edges: []*lnrpc.ChannelEdge{
+			{
+				Node1Pub:    "self",
+				Node2Pub:    "alice",
+				Capacity:    100000,
+				Node1Policy: policy(1000, 1, 1),
+				Node2Policy: policy(2000, 1, 1),
+			},
+			{
+				Node1Pub:    "alice",
+				Node2Pub:    "bob",
+				Capacity:    200000,
+				Node1Policy: policy(500, 1000, 1),
+				Node2Policy: policy(10, 0, 1),
+			},
+			{
+				Node1Pub:    "alice",
+				Node2Pub:    "carol",
+				Capacity:    300000,
+				Node1Policy: policy(1500, 1, 1),
+				Node2Policy: policy(0, 0, 5000),
+			},
+			{
+				Node1Pub: "bob",
+				Node2Pub: "erin",
+				Capacity: 50000,
+				Node1Policy: &lnrpc.RoutingPolicy{
+					MinHtlc:  1,
+					Disabled: true,
+				},
+				Node2Policy: policy(1, 0, 1),
+			},
+			{
+				Node1Pub:    "dave",
+				Node2Pub:    "frank",
+				Capacity:    400000,
+				Node1Policy: policy(1, 0, 1),
+				Node2Policy: policy(1, 0, 1),
+			},
+		},
+	}
+}
+
+func TestScorePeers(t *testing.T) {
+	scores := scorePeers(testGraph(), "self", 1000)
+
+	tests := []struct {
+		node       string
+		fee        int64
+		minHtlc    int64
+		compatible bool
+		channels   int
+		capacity   int64
+		reachable  bool
+	}{
+		// Alice's lowest fee is 500 + 1000*1000/1e6 = 501 msat on the
+		// channel with bob, not the highest fee of 2000 msat.
+		{"alice", 501, 1, true, 3, 600000, true},
+		{"bob", 10, 1, true, 2, 250000, true},
+		{"carol", 0, 5000, false, 1, 300000, true},
+		{"dave", 1, 1, true, 1, 400000, false},
+		{"erin", 1, 1, true, 1, 50000, false},
+	}
+
+	for _, test := range tests {
+		s, ok := scores[test.node]
+		if !ok {
+			t.Fatalf("no score for %v", test.node)
+		}
+
+		if s.compatible != test.compatible {
+			t.Errorf("%v: expected compatible %v, got %v",
+				test.node, test.compatible, s.compatible)
+		}
+		if test.compatible && s.fee != test.fee {
+			t.Errorf("%v: expected fee %v, got %v", test.node,
+				test.fee, s.fee)
+		}
+		if s.minHtlc != test.minHtlc {
+			t.Errorf("%v: expected min htlc %v, got %v",
+				test.node, test.minHtlc, s.minHtlc)
+		}
+		if s.channels != test.channels {
+			t.Errorf("%v: expected %v channels, got %v",
+				test.node, test.channels, s.channels)
+		}
+		if s.capacity != test.capacity {
+			t.Errorf("%v: expected capacity %v, got %v",
+				test.node, test.capacity, s.capacity)
+		}
+		if s.reachable != test.reachable {
+			t.Errorf("%v: expected reachable %v, got %v",
+				test.node, test.reachable, s.reachable)
+		}
+	}
+
+	if scores["alice"].alias != "Alice" {
+		t.Errorf("expected alias Alice, got %v", scores["alice"].alias)
+	}
+}
+
+func TestScorePeersAmount(t *testing.T) {
+	// At 10000 msat carol's min_htlc is met and the proportional part of
+	// alice's fee on the channel with bob outweighs the base fee of her
+	// channel with carol.
+	scores := scorePeers(testGraph(), "self", 10000)
+
+	if !scores["carol"].compatible {
+		t.Fatalf("expected carol to be compatible")
+	}
+	if scores["carol"].fee != 0 {
+		t.Errorf("expected carol fee 0, got %v", scores["carol"].fee)
+	}
+	if scores["alice"].fee != 510 {
+		t.Errorf("expected alice fee 510, got %v", scores["alice"].fee)
+	}
+}
+
+func TestReachableNodes(t *testing.T) {
+	reached := reachableNodes(testGraph(), "self")
+
+	var nodes []string
+	for node := range reached {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	expected := []string{"alice", "bob", "carol", "self"}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Fatalf("expected %v, got %v", expected, nodes)
+	}
+
+	// Erin can reach bob, because only bob disabled his side.
+	if _, ok := reachableNodes(testGraph(), "erin")["bob"]; !ok {
+		t.Fatalf("expected erin to reach bob")
+	}
+}
+
+func TestRankPeers(t *testing.T) {
+	list := []*peerScore{
+		{node: "incompatible", compatible: false, channels: 100},
+		{node: "expensive", compatible: true, fee: 1000, reachable: true},
+		{node: "unreachable", compatible: true, fee: 1},
+		{node: "small", compatible: true, fee: 1, reachable: true,
+			channels: 1, capacity: 1000},
+		{node: "large", compatible: true, fee: 1, reachable: true,
+			channels: 1, capacity: 2000},
+		{node: "connected", compatible: true, fee: 1, reachable: true,
+			channels: 2},
+	}
+
+	rankPeers(list)
+
+	var order []string
+	for _, s := range list {
+		order = append(order, s.node)
+	}
+
+	expected := []string{
+		"connected", "large", "small", "unreachable", "expensive",
+		"incompatible",
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("expected %v, got %v", expected, order)
+	}
+}
+
+func TestRankPeersGraph(t *testing.T) {
+	scores := scorePeers(testGraph(), "self", 1000)
+	delete(scores, "self")
+
+	var list []*peerScore
+	for _, s := range scores {
+		list = append(list, s)
+	}
+	rankPeers(list)
+
+	var order []string
+	for _, s := range list {
+		order = append(order, s.node)
+	}
+
+	// Frank and dave tie on everything but the key.
+	expected := []string{
+		"dave", "frank", "erin", "bob", "alice", "carol",
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("expected %v, got %v", expected, order)
+	}
+}
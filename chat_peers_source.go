@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// candidateSource provides the nodes that chatpeers considers as peers. The
+// candidates are returned as a map from pubkey to alias.
+type candidateSource interface {
+	candidates(graph *lnrpc.ChannelGraph) (map[string]string, error)
+}
+
+type BosScore struct {
+	Alias     string
+	PublicKey string `json:"public_key"`
+}
+
+type BosList struct {
+	Scores []*BosScore
+}
+
+// bosSource fetches the candidates from the "bos list" of
+// nodes.lightning.computer.
+type bosSource struct {
+	network string
+}
+
+func (s *bosSource) url() (string, error) {
+	switch s.network {
+	case "mainnet":
+		return "https://nodes.lightning.computer/availability/v1/btc.json", nil
+	case "testnet":
+		return "https://nodes.lightning.computer/availability/v1/btctestnet.json", nil
+	default:
+		return "", fmt.Errorf("no bos list for network %v", s.network)
+	}
+}
+
+func (s *bosSource) candidates(_ *lnrpc.ChannelGraph) (map[string]string,
+	error) {
+
+	url, err := s.url()
+	if err != nil {
+		return nil, err
+	}
+
+	return fetchBosList(url)
+}
+
+// fetchBosList downloads a list of nodes in the bos list json format.
+func fetchBosList(url string) (map[string]string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch bos list: %v",
+			resp.Status)
+	}
+
+	return decodeBosList(resp.Body)
+}
+
+// decodeBosList decodes a list of nodes in the bos list json format.
+func decodeBosList(r io.Reader) (map[string]string, error) {
+	var bosList BosList
+	if err := json.NewDecoder(r).Decode(&bosList); err != nil {
+		return nil, err
+	}
+
+	bosNodes := make(map[string]string)
+	for _, item := range bosList.Scores {
+		bosNodes[item.PublicKey] = item.Alias
+	}
+	return bosNodes, nil
+}
+
+// fileSource reads the candidates from a local file. Files with a .csv
+// extension contain pubkey,alias records. All other files are expected to be
+// in the bos list json format.
+type fileSource struct {
+	path string
+}
+
+func (s *fileSource) candidates(_ *lnrpc.ChannelGraph) (map[string]string,
+	error) {
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if !strings.EqualFold(filepath.Ext(s.path), ".csv") {
+		return decodeBosList(f)
+	}
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]string)
+	for _, record := range records {
+		if len(record) == 0 || record[0] == "" ||
+			strings.HasPrefix(record[0], "#") {
+
+			continue
+		}
+
+		var alias string
+		if len(record) > 1 {
+			alias = record[1]
+		}
+		nodes[record[0]] = alias
+	}
+
+	return nodes, nil
+}
+
+// graphSource considers all nodes in the graph as candidates. This works on
+// any network and doesn't need internet access.
+type graphSource struct{}
+
+func (s *graphSource) candidates(graph *lnrpc.ChannelGraph) (
+	map[string]string, error) {
+
+	nodes := make(map[string]string)
+	for _, node := range graph.Nodes {
+		nodes[node.PubKey] = node.Alias
+	}
+	return nodes, nil
+}
+
+// cachedSource keeps the last list fetched from a source on disk. The cached
+// list is used while it is younger than maxAge, and as a fallback when the
+// source can't be reached.
+type cachedSource struct {
+	source candidateSource
+	path   string
+	maxAge time.Duration
+}
+
+func (s *cachedSource) candidates(graph *lnrpc.ChannelGraph) (
+	map[string]string, error) {
+
+	cached, modTime, cacheErr := s.read()
+	if cacheErr == nil && time.Since(modTime) < s.maxAge {
+		return cached, nil
+	}
+
+	nodes, err := s.source.candidates(graph)
+	if err != nil {
+		if cacheErr == nil {
+			fmt.Fprintf(os.Stderr, "[whatsat] %v, using cached "+
+				"list from %v\n", err,
+				modTime.Format(time.RFC3339))
+
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	// Failing to update the cache doesn't make the fetched list less
+	// useful.
+	if err := s.write(nodes); err != nil {
+		fmt.Fprintf(os.Stderr, "[whatsat] cannot write candidate "+
+			"cache: %v\n", err)
+	}
+
+	return nodes, nil
+}
+
+func (s *cachedSource) read() (map[string]string, time.Time, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var nodes map[string]string
+	if err := json.Unmarshal(b, &nodes); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return nodes, info.ModTime(), nil
+}
+
+func (s *cachedSource) write(nodes map[string]string) error {
+	b, err := json.Marshal(nodes)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.path, b, 0600)
+}
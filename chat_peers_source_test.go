@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+const testBosList = `{"scores": [
+	{"alias": "Alice", "public_key": "alice", "score": 10},
+	{"alias": "Bob", "public_key": "bob", "score": 5}
+]}`
+
+// fakeSource is a candidate source that returns fixed nodes or an error and
+// counts how often it is asked.
+type fakeSource struct {
+	nodes map[string]string
+	err   error
+	calls int
+}
+
+func (s *fakeSource) candidates(_ *lnrpc.ChannelGraph) (map[string]string,
+	error) {
+
+	s.calls++
+	return s.nodes, s.err
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "whatsat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestBosSourceURL(t *testing.T) {
+	for _, network := range []string{"mainnet", "testnet"} {
+		s := &bosSource{network: network}
+		if _, err := s.url(); err != nil {
+			t.Fatalf("%v: %v", network, err)
+		}
+	}
+
+	s := &bosSource{network: "regtest"}
+	if _, err := s.url(); err == nil {
+		t.Fatal("expected error for regtest")
+	}
+}
+
+func TestFetchBosList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/btc.json" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, testBosList)
+		},
+	))
+	defer server.Close()
+
+	nodes, err := fetchBosList(server.URL + "/btc.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"alice": "Alice", "bob": "Bob"}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Fatalf("expected %v, got %v", expected, nodes)
+	}
+
+	if _, err := fetchBosList(server.URL + "/missing"); err == nil {
+		t.Fatal("expected error for missing list")
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir, cleanUp := tempDir(t)
+	defer cleanUp()
+
+	files := map[string]string{
+		"list.json": testBosList,
+		"list.CSV": "# pubkey,alias\n" +
+			"alice, Alice\n" +
+			"\n" +
+			"carol\n" +
+			"bob,Bob,extra\n",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(
+			filepath.Join(dir, name), []byte(content), 0600,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		expected map[string]string
+	}{
+		{"list.json", map[string]string{
+			"alice": "Alice", "bob": "Bob",
+		}},
+		{"list.CSV", map[string]string{
+			"alice": "Alice", "bob": "Bob", "carol": "",
+		}},
+	}
+	for _, test := range tests {
+		s := &fileSource{path: filepath.Join(dir, test.name)}
+		nodes, err := s.candidates(nil)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(nodes, test.expected) {
+			t.Fatalf("%v: expected %v, got %v", test.name,
+				test.expected, nodes)
+		}
+	}
+
+	s := &fileSource{path: filepath.Join(dir, "missing.json")}
+	if _, err := s.candidates(nil); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestGraphSource(t *testing.T) {
+	nodes, err := (&graphSource{}).candidates(testGraph())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 7 || nodes["carol"] != "Carol" {
+		t.Fatalf("unexpected nodes: %v", nodes)
+	}
+}
+
+func TestCachedSource(t *testing.T) {
+	dir, cleanUp := tempDir(t)
+	defer cleanUp()
+
+	first := map[string]string{"alice": "Alice"}
+	second := map[string]string{"bob": "Bob"}
+
+	source := &fakeSource{nodes: first}
+	s := &cachedSource{
+		source: source,
+		path:   filepath.Join(dir, "cache", "bos.json"),
+		maxAge: time.Hour,
+	}
+
+	candidates := func(expected map[string]string, calls int) {
+		t.Helper()
+
+		nodes, err := s.candidates(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(nodes, expected) {
+			t.Fatalf("expected %v, got %v", expected, nodes)
+		}
+		if source.calls != calls {
+			t.Fatalf("expected %v fetches, got %v", calls,
+				source.calls)
+		}
+	}
+
+	// The first call fetches the list, the second uses the cache.
+	candidates(first, 1)
+	source.nodes = second
+	candidates(first, 1)
+
+	// An expired cache is refreshed.
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(s.path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	candidates(second, 2)
+
+	// The expired cache is the fallback when the source fails.
+	if err := os.Chtimes(s.path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	source.err = fmt.Errorf("offline")
+	candidates(second, 3)
+
+	// Without a cache, the error is returned.
+	if err := os.Remove(s.path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.candidates(nil); err != source.err {
+		t.Fatalf("expected source error, got %v", err)
+	}
+}
+
+func TestCachedSourceWriteFailure(t *testing.T) {
+	dir, cleanUp := tempDir(t)
+	defer cleanUp()
+
+	// The cache can't be written below a regular file.
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"alice": "Alice"}
+	s := &cachedSource{
+		source: &fakeSource{nodes: expected},
+		path:   filepath.Join(file, "bos.json"),
+		maxAge: time.Hour,
+	}
+
+	nodes, err := s.candidates(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Fatalf("expected %v, got %v", expected, nodes)
+	}
+}
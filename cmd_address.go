@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+)
+
+var addressCommand = cli.Command{
+	Name:     "address",
+	Category: "Chat",
+	Usage:    "Show the chat address that others can use to message us.",
+	Description: `
+	The chat address contains our public key and route hints for our
+	private channels. Nodes that only have private channels can't be found
+	by senders without those hints. The address can be passed to the chat
+	command or used as a destination with /<address>.`,
+	Action: actionDecorator(address),
+}
+
+func address(ctx *cli.Context) error {
+	client, cleanUp := getClient(ctx)
+	defer cleanUp()
+
+	addr, err := getChatAddress(client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(addr)
+
+	return nil
+}
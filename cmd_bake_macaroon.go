@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/urfave/cli"
+)
+
+const defaultWhatsatMacaroonFilename = "whatsat.macaroon"
+
+// whatsatPermissions are the permissions that whatsat needs for chatting and
+// for the read-only commands. Admin operations like opening channels and
+// updating channel policies still need a more powerful macaroon.
+var whatsatPermissions = []*lnrpc.MacaroonPermission{
+	// Sending payments and querying routes.
+	{Entity: "offchain", Action: "read"},
+	{Entity: "offchain", Action: "write"},
+
+	// Receiving messages through the invoice subscription.
+	{Entity: "invoices", Action: "read"},
+
+	// Signing and verifying messages.
+	{Entity: "signer", Action: "generate"},
+	{Entity: "signer", Action: "read"},
+
+	// Node info and the channel graph.
+	{Entity: "info", Action: "read"},
+
+	// Listing the peers that we are already connected to.
+	{Entity: "peers", Action: "read"},
+}
+
+var bakeMacaroonCommand = cli.Command{
+	Name:     "bakemacaroon",
+	Category: "Setup",
+	Usage: "Bake a macaroon with only the permissions that whatsat " +
+		"needs.",
+	Description: `
+	Bakes a macaroon that allows chatting, but doesn't give access to the
+	node's on-chain funds or channel management. It is saved in the whatsat
+	data directory for the node at --rpcserver and used instead of lnd's
+	admin.macaroon when connecting to that node from then on, unless
+	--macaroonpath is set.
+
+	Baking requires a macaroon with the permission to bake macaroons, so
+	this command always uses lnd's admin.macaroon by default.
+
+	Opening channels (chatpeers --open) and updating channel policies
+	(chatpolicy --apply) aren't possible with this macaroon. Pass
+	--macaroonpath to use the admin macaroon for those.`,
+	Action: actionDecorator(bakeMacaroon),
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name: "save_to",
+			Usage: "path to save the macaroon to instead of the " +
+				"whatsat data directory",
+		},
+	},
+}
+
+func bakeMacaroon(ctx *cli.Context) error {
+	client, cleanUp := getClient(ctx)
+	defer cleanUp()
+
+	resp, err := client.BakeMacaroon(
+		context.Background(), &lnrpc.BakeMacaroonRequest{
+			Permissions: whatsatPermissions,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	macBytes, err := hex.DecodeString(resp.Macaroon)
+	if err != nil {
+		return err
+	}
+
+	path := cleanAndExpandPath(ctx.String("save_to"))
+	if path == "" {
+		var lndConn *lndConnect
+		if uri := ctx.GlobalString("lndconnect"); uri != "" {
+			lndConn, err = parseLndConnect(uri)
+			if err != nil {
+				return err
+			}
+		}
+
+		path, err = whatsatMacaroonPath(ctx, lndConn)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, macBytes, 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("Macaroon saved to %v\n", path)
+
+	return nil
+}
+
+// whatsatMacaroonPath returns the path of the baked whatsat macaroon for the
+// node and the active chain and network in the data directory. Macaroons are
+// kept per node address, so that a macaroon of one node is never sent to
+// another.
+func whatsatMacaroonPath(ctx *cli.Context, lndConn *lndConnect) (string,
+	error) {
+
+	chain, network, err := getChainAndNetwork(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	node := strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(
+		nodeAddress(ctx, lndConn),
+	)
+
+	return filepath.Join(
+		getDataDir(ctx), chain, network, node,
+		defaultWhatsatMacaroonFilename,
+	), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/macaroons"
+	"github.com/urfave/cli"
+	macaroon "gopkg.in/macaroon.v2"
+)
+
+// globalContext returns a command context with the global flags set.
+func globalContext(t *testing.T, flags map[string]string) *cli.Context {
+	set := flag.NewFlagSet("whatsat", flag.ContinueOnError)
+	set.String("datadir", "/data", "")
+	set.String("chain", "bitcoin", "")
+	set.String("network", "testnet", "")
+	set.String("rpcserver", defaultRPCHostPort, "")
+
+	for name, value := range flags {
+		if err := set.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	global := cli.NewContext(nil, set, nil)
+	return cli.NewContext(
+		nil, flag.NewFlagSet("cmd", flag.ContinueOnError), global,
+	)
+}
+
+func TestWhatsatMacaroonPath(t *testing.T) {
+	tests := []struct {
+		flags    map[string]string
+		lndConn  *lndConnect
+		expected string
+	}{
+		{
+			flags:    nil,
+			expected: "bitcoin/testnet/localhost_10009",
+		},
+		{
+			flags: map[string]string{
+				"rpcserver": "node-b:10009",
+				"network":   "regtest",
+			},
+			expected: "bitcoin/regtest/node-b_10009",
+		},
+		{
+			lndConn:  &lndConnect{host: "node-c:10009"},
+			expected: "bitcoin/testnet/node-c_10009",
+		},
+		{
+			// An explicit rpc server overrides the uri host.
+			flags:    map[string]string{"rpcserver": "node-d:1"},
+			lndConn:  &lndConnect{host: "node-c:10009"},
+			expected: "bitcoin/testnet/node-d_1",
+		},
+	}
+
+	for _, test := range tests {
+		path, err := whatsatMacaroonPath(
+			globalContext(t, test.flags), test.lndConn,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := filepath.Join(
+			"/data", test.expected, defaultWhatsatMacaroonFilename,
+		)
+		if path != expected {
+			t.Errorf("expected %v, got %v", expected, path)
+		}
+	}
+}
+
+// timeBefore returns the time of the last time-before caveat of the macaroon
+// in the request metadata.
+func timeBefore(t *testing.T, md map[string]string) (time.Time, bool) {
+	macBytes, err := hex.DecodeString(md["macaroon"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := &macaroon.Macaroon{}
+	if err := mac.UnmarshalBinary(macBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	var before time.Time
+	var found bool
+	for _, caveat := range mac.Caveats() {
+		parts := strings.SplitN(string(caveat.Id), " ", 2)
+		if len(parts) != 2 || parts[0] != "time-before" {
+			continue
+		}
+
+		before, err = time.Parse(time.RFC3339Nano, parts[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		found = true
+	}
+
+	return before, found
+}
+
+func TestTimeoutMacaroonCredential(t *testing.T) {
+	mac, err := macaroon.New([]byte("key"), []byte("id"), "lnd",
+		macaroon.LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cred := timeoutMacaroonCredential{
+		MacaroonCredential: macaroons.NewMacaroonCredential(mac),
+		timeout:            60,
+	}
+
+	// Every call gets a caveat relative to the time of the call.
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		md, err := cred.GetRequestMetadata(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		before, ok := timeBefore(t, md)
+		if !ok {
+			t.Fatal("no timeout caveat")
+		}
+		if before.Before(start.Add(59*time.Second)) ||
+			before.After(time.Now().Add(61*time.Second)) {
+
+			t.Fatalf("unexpected timeout %v", before)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The timeout isn't accumulated on the stored macaroon.
+	if len(cred.Macaroon.Caveats()) != 0 {
+		t.Fatal("caveat added to the stored macaroon")
+	}
+
+	cred.timeout = 0
+	md, err := cred.GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := timeBefore(t, md); ok {
+		t.Fatal("unexpected timeout caveat")
+	}
+}
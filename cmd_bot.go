@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/routing/route"
+	"github.com/urfave/cli"
+
+	"whatsat/bot"
+)
+
+var botCommand = cli.Command{
+	Name:     "bot",
+	Category: "Chat",
+	Usage:    "Run an example bot that answers chat commands.",
+	Description: `
+	Answer incoming messages automatically. The bot knows the commands
+	!ping, which is answered with pong, and !info, which is answered with
+	information about the node. Other messages are ignored.
+
+	Every reply is a paid chat message, so the number of messages per sender
+	that are answered is limited.`,
+	Action: actionDecorator(runBot),
+	Flags: append([]cli.Flag{
+		cli.Uint64Flag{
+			Name:  "amt_msat",
+			Usage: "payment amount per chat message",
+			Value: 1000,
+		},
+		cli.IntFlag{
+			Name:  "rate_limit",
+			Usage: "maximum number of messages per sender to answer",
+			Value: 5,
+		},
+		cli.DurationFlag{
+			Name:  "rate_interval",
+			Usage: "interval that the rate limit applies to",
+			Value: time.Minute,
+		},
+	}, paymentPolicyFlags...),
+}
+
+// engineSender sends bot replies through the chat engine.
+type engineSender struct {
+	engine *chatEngine
+}
+
+func (s *engineSender) Send(dest route.Vertex, text string) error {
+	return s.engine.send(dest, text, func(u *deliveryUpdate) {
+		if u.state == statePending {
+			return
+		}
+
+		fmt.Printf("Reply to %v %v\n", aliasOrKey(dest), u.state)
+	})
+}
+
+func runBot(ctx *cli.Context) error {
+	conn := getClientConn(ctx, false)
+	defer conn.Close()
+
+	var err error
+	engine, err = newChatEngine(conn, int64(ctx.Uint64("amt_msat")))
+	if err != nil {
+		return err
+	}
+
+	if err := initPolicies(ctx); err != nil {
+		return err
+	}
+
+	if err := initHooks(ctx); err != nil {
+		return err
+	}
+
+	b := bot.New(&bot.Config{
+		Sender:       &engineSender{engine: engine},
+		RateLimit:    ctx.Int("rate_limit"),
+		RateInterval: ctx.Duration("rate_interval"),
+		OnError: func(msg *bot.Message, err error) {
+			fmt.Printf("Cannot answer %v: %v\n",
+				aliasOrKey(msg.Sender), err)
+		},
+	})
+
+	b.HandleCommand("!ping", func(req *bot.Request) (string, error) {
+		return "pong", nil
+	})
+
+	b.HandleCommand("!info", func(req *bot.Request) (string, error) {
+		info, err := engine.mainRpc.GetInfo(
+			context.Background(), &lnrpc.GetInfoRequest{},
+		)
+		if err != nil {
+			return "", err
+		}
+
+		return formatNodeInfo(info), nil
+	})
+
+	receiveCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- engine.receive(receiveCtx,
+			func(msg *receivedMessage) {
+				fmt.Printf("%v: %v\n", aliasOrKey(msg.sender),
+					msg.text)
+
+				b.Handle(&bot.Message{
+					Sender:    msg.sender,
+					Alias:     keyToAlias[msg.sender],
+					Text:      msg.text,
+					Timestamp: msg.timestamp,
+					AmtMsat:   msg.amtMsat,
+				})
+			}, nil,
+		)
+	}()
+
+	fmt.Println("Bot is running, press ctrl-c to stop")
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-errChan:
+		return err
+	case <-sigChan:
+		return nil
+	}
+}
+
+// formatNodeInfo summarizes the node for the !info reply.
+func formatNodeInfo(info *lnrpc.GetInfoResponse) string {
+	var chains []string
+	for _, c := range info.Chains {
+		chains = append(chains, c.Chain+"/"+c.Network)
+	}
+
+	return fmt.Sprintf("%v (%v)\n"+
+		"lnd %v on %v\n"+
+		"channels: %v active, %v inactive, %v pending\n"+
+		"peers: %v\n"+
+		"block height: %v, synced to chain: %v",
+		info.Alias, info.IdentityPubkey,
+		info.Version, strings.Join(chains, ", "),
+		info.NumActiveChannels, info.NumInactiveChannels,
+		info.NumPendingChannels,
+		info.NumPeers,
+		info.BlockHeight, info.SyncedToChain,
+	)
+}
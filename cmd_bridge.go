@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// echoTTL is the time during which a relayed message is recognized when it
+// comes back.
+const echoTTL = 5 * time.Minute
+
+var bridgeCommand = cli.Command{
+	Name:     "bridge",
+	Category: "Chat",
+	Usage:    "Relay messages between whatsat and other chat networks.",
+	Subcommands: []cli.Command{
+		bridgeIRCCommand, bridgeMatrixCommand, bridgeSMTPCommand,
+	},
+}
+
+// bridgeFlags are the flags that all bridges share.
+var bridgeFlags = append([]cli.Flag{
+	cli.Uint64Flag{
+		Name:  "amt_msat",
+		Usage: "payment amount per chat message",
+		Value: 1000,
+	},
+}, paymentPolicyFlags...)
+
+// echoFilter recognizes messages that a bridge relayed itself, so that they
+// aren't relayed back when another bridge or a client echoes them.
+type echoFilter struct {
+	mtx  sync.Mutex
+	sent map[string]time.Time
+}
+
+func newEchoFilter() *echoFilter {
+	return &echoFilter{
+		sent: make(map[string]time.Time),
+	}
+}
+
+// add records a relayed message.
+func (f *echoFilter) add(text string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	now := time.Now()
+	for t, sent := range f.sent {
+		if now.Sub(sent) > echoTTL {
+			delete(f.sent, t)
+		}
+	}
+
+	f.sent[text] = now
+}
+
+// isEcho returns whether the message was relayed recently. A message is only
+// recognized once.
+func (f *echoFilter) isEcho(text string) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	sent, ok := f.sent[text]
+	if !ok {
+		return false
+	}
+	delete(f.sent, text)
+
+	return time.Since(sent) <= echoTTL
+}
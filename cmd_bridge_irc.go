@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+	"github.com/urfave/cli"
+)
+
+var bridgeIRCCommand = cli.Command{
+	Name:      "irc",
+	ArgsUsage: "peer [peer ...]",
+	Usage:     "Relay messages between an irc channel and whatsat peers.",
+	Description: `
+	Connect to an irc server and relay messages between the irc target and
+	the whatsat peers, given as pubkeys, aliases or chat addresses. The
+	target is either a #channel or the nickname of a user to chat with in
+	a query.
+
+	Messages are prefixed with the nickname of the irc user or the alias of
+	the whatsat peer. With multiple peers, the bridge acts as a group: a
+	message from one peer is also relayed to the others. Messages that the
+	bridge relayed itself are recognized and not relayed back.`,
+	Action: actionDecorator(bridgeIRC),
+	Flags: append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "server",
+			Usage: "host:port of the irc server",
+			Value: "localhost:6667",
+		},
+		cli.BoolFlag{
+			Name:  "tls",
+			Usage: "connect to the irc server over tls",
+		},
+		cli.StringFlag{
+			Name:  "nick",
+			Usage: "nickname of the bridge",
+			Value: "whatsat",
+		},
+		cli.StringFlag{
+			Name:   "password",
+			Usage:  "irc server password",
+			EnvVar: "WHATSAT_IRC_PASSWORD",
+		},
+		cli.StringFlag{
+			Name:  "target",
+			Usage: "irc #channel or nickname to relay messages with",
+		},
+	}, bridgeFlags...),
+}
+
+// ircBridge relays messages between an irc target and whatsat peers.
+type ircBridge struct {
+	irc    *ircClient
+	target string
+	peers  []route.Vertex
+	echo   *echoFilter
+}
+
+func bridgeIRC(ctx *cli.Context) error {
+	target := ctx.String("target")
+	if target == "" {
+		return fmt.Errorf("no irc target specified")
+	}
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("no peers specified")
+	}
+
+	conn := getClientConn(ctx, false)
+	defer conn.Close()
+
+	var err error
+	engine, err = newChatEngine(conn, int64(ctx.Uint64("amt_msat")))
+	if err != nil {
+		return err
+	}
+
+	if err := initPolicies(ctx); err != nil {
+		return err
+	}
+
+	if err := initHooks(ctx); err != nil {
+		return err
+	}
+
+	var peers []route.Vertex
+	for _, arg := range ctx.Args() {
+		peer, err := resolveDest(arg)
+		if err != nil {
+			return err
+		}
+		peers = append(peers, peer)
+	}
+
+	irc, err := dialIRC(
+		ctx.String("server"), ctx.Bool("tls"), ctx.String("nick"),
+		ctx.String("password"),
+	)
+	if err != nil {
+		return err
+	}
+	defer irc.close()
+
+	if strings.HasPrefix(target, "#") {
+		if err := irc.join(target); err != nil {
+			return err
+		}
+	}
+
+	b := &ircBridge{
+		irc:    irc,
+		target: target,
+		peers:  peers,
+		echo:   newEchoFilter(),
+	}
+
+	receiveCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errChan := make(chan error, 2)
+	go func() {
+		errChan <- engine.receive(receiveCtx, b.fromChat, nil)
+	}()
+	go func() {
+		errChan <- irc.run(b.fromIRC)
+	}()
+
+	fmt.Printf("Bridging %v as %v, press ctrl-c to stop\n", target,
+		irc.nick)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-errChan:
+		return err
+	case <-sigChan:
+		return nil
+	}
+}
+
+// fromIRC relays a message from the irc target to the whatsat peers.
+func (b *ircBridge) fromIRC(msg *ircMessage) {
+	if msg.command != "PRIVMSG" || len(msg.params) != 2 {
+		return
+	}
+
+	from := msg.nick()
+	if strings.EqualFold(from, b.irc.nick) {
+		return
+	}
+
+	to := msg.params[0]
+	if strings.HasPrefix(b.target, "#") {
+		if !strings.EqualFold(to, b.target) {
+			return
+		}
+	} else if !strings.EqualFold(to, b.irc.nick) ||
+		!strings.EqualFold(from, b.target) {
+
+		return
+	}
+
+	text := msg.params[1]
+	if b.echo.isEcho(text) {
+		return
+	}
+
+	// Relay actions (/me), but no other ctcp messages.
+	if strings.HasPrefix(text, "\x01") {
+		action := strings.TrimPrefix(text, "\x01ACTION ")
+		if action == text {
+			return
+		}
+		action = strings.TrimSuffix(action, "\x01")
+		text = fmt.Sprintf("* %v %v", from, action)
+	} else {
+		text = fmt.Sprintf("<%v> %v", from, text)
+	}
+
+	b.echo.add(text)
+	for _, peer := range b.peers {
+		b.sendChat(peer, text)
+	}
+}
+
+// fromChat relays a message from one of the whatsat peers to the irc target
+// and the other peers.
+func (b *ircBridge) fromChat(msg *receivedMessage) {
+	if !b.isPeer(msg.sender) || b.echo.isEcho(msg.text) {
+		return
+	}
+
+	nick := ircNick(aliasOrKey(msg.sender))
+
+	var lines []string
+	for _, line := range strings.Split(msg.text, "\n") {
+		line = fmt.Sprintf("<%v> %v", nick, line)
+		b.echo.add(line)
+		lines = append(lines, line)
+	}
+	text := strings.Join(lines, "\n")
+
+	if err := b.irc.privmsg(b.target, text); err != nil {
+		fmt.Printf("Cannot relay to irc: %v\n", err)
+	}
+
+	for _, peer := range b.peers {
+		if peer != msg.sender {
+			b.sendChat(peer, text)
+		}
+	}
+}
+
+func (b *ircBridge) isPeer(key route.Vertex) bool {
+	for _, peer := range b.peers {
+		if peer == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sendChat sends a relayed message to a whatsat peer and reports failures.
+func (b *ircBridge) sendChat(peer route.Vertex, text string) {
+	err := engine.send(peer, text, func(u *deliveryUpdate) {
+		if u.state == stateFailed {
+			fmt.Printf("Cannot relay to %v: message failed\n",
+				aliasOrKey(peer))
+		}
+	})
+	if err != nil {
+		fmt.Printf("Cannot relay to %v: %v\n", aliasOrKey(peer), err)
+	}
+}
+
+// ircNick turns an alias into a valid irc nickname by replacing characters
+// that aren't allowed.
+func ircNick(alias string) string {
+	nick := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9':
+
+			return r
+
+		case strings.ContainsRune("-[]\\`^{}|_", r):
+			return r
+		}
+		return '_'
+	}, alias)
+
+	if nick == "" {
+		return "_"
+	}
+
+	return nick
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+	"github.com/urfave/cli"
+)
+
+// matrixMaxTxns is the number of transaction ids that are remembered to
+// recognize retried transactions. The homeserver only retries recent ones.
+const matrixMaxTxns = 1000
+
+var bridgeMatrixCommand = cli.Command{
+	Name:      "matrix",
+	ArgsUsage: "[peer ...]",
+	Usage:     "Mirror whatsat conversations into matrix rooms.",
+	Description: `
+	Run as a matrix application service that mirrors every whatsat
+	conversation into its own matrix room. Incoming whatsat messages are
+	posted to the room of the sender, which is created and shared with the
+	--invite users when the first message arrives. Messages that matrix
+	users post in a room are sent to the peer as whatsat messages. Rooms
+	for the peers given as arguments are created at startup, so that
+	conversations can be started from matrix.
+
+	The application service needs to be registered with the homeserver.
+	The registration file must contain the tokens, the --listen address as
+	url and the sender_localpart of --bot_user.
+
+	The mapping between peers and rooms is stored in matrix_rooms.json in
+	the data directory.`,
+	Action: actionDecorator(bridgeMatrix),
+	Flags: append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "homeserver",
+			Usage: "url of the matrix homeserver",
+			Value: "http://localhost:8008",
+		},
+		cli.StringFlag{
+			Name:   "as_token",
+			Usage:  "as_token of the registration",
+			EnvVar: "WHATSAT_MATRIX_AS_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "hs_token",
+			Usage:  "hs_token of the registration",
+			EnvVar: "WHATSAT_MATRIX_HS_TOKEN",
+		},
+		cli.StringFlag{
+			Name:  "listen",
+			Usage: "host:port to receive homeserver events on",
+			Value: "localhost:9009",
+		},
+		cli.StringFlag{
+			Name: "bot_user",
+			Usage: "user id of the bridge, e.g. " +
+				"@whatsat:example.com",
+		},
+		cli.StringSliceFlag{
+			Name: "invite",
+			Usage: "user id to invite into new rooms; can be " +
+				"specified multiple times",
+		},
+	}, bridgeFlags...),
+}
+
+// matrixEvent is an event that the homeserver pushes to the application
+// service.
+type matrixEvent struct {
+	Type    string `json:"type"`
+	RoomID  string `json:"room_id"`
+	Sender  string `json:"sender"`
+	Content struct {
+		MsgType string `json:"msgtype"`
+		Body    string `json:"body"`
+	} `json:"content"`
+}
+
+// matrixBridge is the application service that relays messages between matrix
+// rooms and whatsat peers.
+type matrixBridge struct {
+	client  *matrixClient
+	rooms   *matrixRooms
+	hsToken string
+	botUser string
+	invite  []string
+
+	// txns holds the ids of processed transactions, txnOrder the same ids
+	// from old to new, so that the oldest can be forgotten.
+	txnMtx   sync.Mutex
+	txns     map[string]struct{}
+	txnOrder []string
+}
+
+func bridgeMatrix(ctx *cli.Context) error {
+	for _, flag := range []string{"as_token", "hs_token", "bot_user"} {
+		if ctx.String(flag) == "" {
+			return fmt.Errorf("%v is required", flag)
+		}
+	}
+
+	rooms, err := loadMatrixRooms(
+		filepath.Join(getDataDir(ctx), matrixRoomsFilename),
+	)
+	if err != nil {
+		return err
+	}
+
+	conn := getClientConn(ctx, false)
+	defer conn.Close()
+
+	engine, err = newChatEngine(conn, int64(ctx.Uint64("amt_msat")))
+	if err != nil {
+		return err
+	}
+
+	if err := initPolicies(ctx); err != nil {
+		return err
+	}
+
+	if err := initHooks(ctx); err != nil {
+		return err
+	}
+
+	b := &matrixBridge{
+		client: newMatrixClient(
+			strings.TrimRight(ctx.String("homeserver"), "/"),
+			ctx.String("as_token"),
+		),
+		rooms:   rooms,
+		hsToken: ctx.String("hs_token"),
+		botUser: ctx.String("bot_user"),
+		invite:  ctx.StringSlice("invite"),
+		txns:    make(map[string]struct{}),
+	}
+
+	for _, arg := range ctx.Args() {
+		peer, err := resolveDest(arg)
+		if err != nil {
+			return err
+		}
+		if _, err := b.ensureRoom(peer); err != nil {
+			return err
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_matrix/app/v1/transactions/", b.handleTransaction)
+	mux.HandleFunc("/transactions/", b.handleTransaction)
+	server := &http.Server{
+		Addr:    ctx.String("listen"),
+		Handler: mux,
+	}
+
+	receiveCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errChan := make(chan error, 2)
+	go func() {
+		errChan <- engine.receive(receiveCtx, b.fromChat, nil)
+	}()
+	go func() {
+		errChan <- server.ListenAndServe()
+	}()
+
+	fmt.Printf("Bridging to %v, listening on %v, press ctrl-c to stop\n",
+		ctx.String("homeserver"), ctx.String("listen"))
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-errChan:
+	case <-sigChan:
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(
+		context.Background(), shutdownTimeout,
+	)
+	defer cancelShutdown()
+
+	if shutdownErr := server.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
+	}
+
+	return err
+}
+
+// ensureRoom returns the room of the peer and creates it if there is none yet.
+func (b *matrixBridge) ensureRoom(peer route.Vertex) (string, error) {
+	if roomID, ok := b.rooms.room(peer); ok {
+		return roomID, nil
+	}
+
+	roomID, err := b.client.createRoom(
+		aliasOrKey(peer), "whatsat chat with "+peer.String(), b.invite,
+	)
+	if err != nil {
+		return "", fmt.Errorf("cannot create room for %v: %v",
+			aliasOrKey(peer), err)
+	}
+
+	if err := b.rooms.add(peer, roomID); err != nil {
+		return "", err
+	}
+
+	return roomID, nil
+}
+
+// fromChat posts an incoming whatsat message to the room of the sender.
+func (b *matrixBridge) fromChat(msg *receivedMessage) {
+	roomID, err := b.ensureRoom(msg.sender)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := b.client.sendMessage(roomID, "m.text", msg.text); err != nil {
+		fmt.Printf("Cannot relay to matrix: %v\n", err)
+	}
+}
+
+// handleTransaction receives a transaction of events from the homeserver.
+func (b *matrixBridge) handleTransaction(w http.ResponseWriter,
+	r *http.Request) {
+
+	token := r.URL.Query().Get("access_token")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(b.hsToken)) != 1 {
+		writeMatrixError(w, http.StatusForbidden, "M_FORBIDDEN",
+			"invalid token")
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		writeMatrixError(w, http.StatusMethodNotAllowed,
+			"M_UNRECOGNIZED", "method not allowed")
+		return
+	}
+
+	var txn struct {
+		Events []*matrixEvent `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&txn); err != nil {
+		writeMatrixError(w, http.StatusBadRequest, "M_NOT_JSON",
+			err.Error())
+		return
+	}
+
+	// The homeserver retries transactions that weren't acknowledged.
+	// Events of a transaction that was processed before are skipped.
+	txnID := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if !b.seenTxn(txnID) {
+		for _, event := range txn.Events {
+			b.fromMatrix(event)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte("{}"))
+}
+
+// seenTxn records the transaction id and returns whether it was processed
+// before.
+func (b *matrixBridge) seenTxn(txnID string) bool {
+	b.txnMtx.Lock()
+	defer b.txnMtx.Unlock()
+
+	if _, ok := b.txns[txnID]; ok {
+		return true
+	}
+
+	b.txns[txnID] = struct{}{}
+	b.txnOrder = append(b.txnOrder, txnID)
+	if len(b.txnOrder) > matrixMaxTxns {
+		delete(b.txns, b.txnOrder[0])
+		b.txnOrder = b.txnOrder[1:]
+	}
+
+	return false
+}
+
+// fromMatrix sends a message that a matrix user posted in a bridged room to
+// the peer of the room.
+func (b *matrixBridge) fromMatrix(event *matrixEvent) {
+	// Our own events come back in transactions too.
+	if event.Type != "m.room.message" || event.Sender == b.botUser {
+		return
+	}
+
+	text := event.Content.Body
+	switch event.Content.MsgType {
+	case "m.text", "m.notice":
+	case "m.emote":
+		text = fmt.Sprintf("* %v %v", event.Sender, text)
+	default:
+		return
+	}
+
+	peer, ok := b.rooms.peer(event.RoomID)
+	if !ok {
+		return
+	}
+
+	err := engine.send(peer, text, func(u *deliveryUpdate) {
+		if u.state != stateFailed {
+			return
+		}
+
+		err := b.client.sendMessage(event.RoomID, "m.notice",
+			"Message could not be delivered: "+text)
+		if err != nil {
+			fmt.Printf("Cannot relay to matrix: %v\n", err)
+		}
+	})
+	if err != nil {
+		fmt.Printf("Cannot relay to %v: %v\n", aliasOrKey(peer), err)
+	}
+}
+
+func writeMatrixError(w http.ResponseWriter, status int, errCode,
+	msg string) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&matrixError{
+		ErrCode: errCode,
+		Err:     msg,
+	})
+}
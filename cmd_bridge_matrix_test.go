@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+// fakeHomeserver is a stand-in for the client-server api of a matrix
+// homeserver. It records the rooms that are created and the messages that
+// are sent.
+type fakeHomeserver struct {
+	server *httptest.Server
+	token  string
+
+	mtx      sync.Mutex
+	rooms    map[string][]string
+	messages []fakeMatrixMessage
+}
+
+type fakeMatrixMessage struct {
+	roomID  string
+	msgType string
+	body    string
+}
+
+func newFakeHomeserver(token string) *fakeHomeserver {
+	h := &fakeHomeserver{
+		token: token,
+		rooms: make(map[string][]string),
+	}
+	h.server = httptest.NewServer(http.HandlerFunc(h.handle))
+
+	return h
+}
+
+func (h *fakeHomeserver) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+h.token {
+		writeMatrixError(w, http.StatusUnauthorized,
+			"M_UNKNOWN_TOKEN", "invalid token")
+		return
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	const roomsPrefix = "/_matrix/client/r0/rooms/"
+	switch {
+	case r.Method == http.MethodPost &&
+		r.URL.Path == "/_matrix/client/r0/createRoom":
+
+		var req struct {
+			Invite []string `json:"invite"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeMatrixError(w, http.StatusBadRequest,
+				"M_NOT_JSON", err.Error())
+			return
+		}
+
+		roomID := fmt.Sprintf("!room%v:test", len(h.rooms)+1)
+		h.rooms[roomID] = req.Invite
+
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"room_id": roomID,
+		})
+
+	case r.Method == http.MethodPut &&
+		strings.HasPrefix(r.URL.Path, roomsPrefix):
+
+		parts := strings.Split(
+			strings.TrimPrefix(r.URL.Path, roomsPrefix), "/",
+		)
+		if len(parts) != 4 || parts[1] != "send" {
+			writeMatrixError(w, http.StatusNotFound,
+				"M_UNRECOGNIZED", "unknown path")
+			return
+		}
+
+		var req struct {
+			MsgType string `json:"msgtype"`
+			Body    string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeMatrixError(w, http.StatusBadRequest,
+				"M_NOT_JSON", err.Error())
+			return
+		}
+
+		h.messages = append(h.messages, fakeMatrixMessage{
+			roomID:  parts[0],
+			msgType: req.MsgType,
+			body:    req.Body,
+		})
+		_, _ = w.Write([]byte(`{"event_id": "$event"}`))
+
+	default:
+		writeMatrixError(w, http.StatusNotFound, "M_UNRECOGNIZED",
+			"unknown path")
+	}
+}
+
+// testMatrixBridge sets up a bridge against a fake homeserver and a fake lnd.
+func testMatrixBridge(t *testing.T) (*matrixBridge, *fakeHomeserver,
+	*fakeLnd, func()) {
+
+	lnd, stopLnd := testEngine(t)
+
+	dir, err := ioutil.TempDir("", "whatsat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rooms, err := loadMatrixRooms(filepath.Join(dir, matrixRoomsFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := newFakeHomeserver("as_token")
+
+	b := &matrixBridge{
+		client:  newMatrixClient(hs.server.URL, "as_token"),
+		rooms:   rooms,
+		hsToken: "hs_token",
+		botUser: "@whatsat:test",
+		invite:  []string{"@alice:test"},
+		txns:    make(map[string]struct{}),
+	}
+
+	cleanUp := func() {
+		hs.server.Close()
+		stopLnd()
+		os.RemoveAll(dir)
+	}
+
+	return b, hs, lnd, cleanUp
+}
+
+// putTransaction pushes a transaction to the bridge like the homeserver does.
+func putTransaction(b *matrixBridge, method, token, txnID string,
+	events ...*matrixEvent) *httptest.ResponseRecorder {
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"events": events,
+	})
+	req := httptest.NewRequest(
+		method, "/_matrix/app/v1/transactions/"+txnID,
+		strings.NewReader(string(body)),
+	)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	b.handleTransaction(w, req)
+
+	return w
+}
+
+func textEvent(roomID, sender, msgType, body string) *matrixEvent {
+	event := &matrixEvent{
+		Type:   "m.room.message",
+		RoomID: roomID,
+		Sender: sender,
+	}
+	event.Content.MsgType = msgType
+	event.Content.Body = body
+
+	return event
+}
+
+// sentTexts collects the texts of the next n payments.
+func sentTexts(t *testing.T, lnd *fakeLnd, n int) []string {
+	var texts []string
+	for i := 0; i < n; i++ {
+		select {
+		case req := <-lnd.payments:
+			texts = append(
+				texts, string(req.DestCustomRecords[tlvMsgRecord]),
+			)
+
+		case <-time.After(testTimeout):
+			t.Fatalf("expected %v payments, got %v", n, len(texts))
+		}
+	}
+	sort.Strings(texts)
+
+	return texts
+}
+
+func expectNoPayment(t *testing.T, lnd *fakeLnd) {
+	select {
+	case req := <-lnd.payments:
+		t.Fatalf("unexpected payment: %q",
+			req.DestCustomRecords[tlvMsgRecord])
+
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMatrixTransactionAuth(t *testing.T) {
+	b, _, _, cleanUp := testMatrixBridge(t)
+	defer cleanUp()
+
+	w := putTransaction(b, http.MethodPut, "wrong", "1")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected forbidden, got %v", w.Code)
+	}
+
+	w = putTransaction(b, http.MethodGet, "hs_token", "1")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected method not allowed, got %v", w.Code)
+	}
+
+	req := httptest.NewRequest(
+		http.MethodPut, "/transactions/1?access_token=hs_token",
+		strings.NewReader("{"),
+	)
+	w = httptest.NewRecorder()
+	b.handleTransaction(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected bad request, got %v", w.Code)
+	}
+}
+
+func TestMatrixTransaction(t *testing.T) {
+	b, _, lnd, cleanUp := testMatrixBridge(t)
+	defer cleanUp()
+
+	peer, err := route.NewVertexFromStr(testPeerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.rooms.add(peer, "!bob:test"); err != nil {
+		t.Fatal(err)
+	}
+
+	events := []*matrixEvent{
+		textEvent("!bob:test", "@alice:test", "m.text", "hello"),
+		textEvent("!bob:test", "@alice:test", "m.emote", "waves"),
+
+		// Not relayed: our own message, an image and a message in
+		// a room that isn't bridged.
+		textEvent("!bob:test", "@whatsat:test", "m.text", "echo"),
+		textEvent("!bob:test", "@alice:test", "m.image", "cat.png"),
+		textEvent("!other:test", "@alice:test", "m.text", "other"),
+	}
+
+	w := putTransaction(b, http.MethodPut, "hs_token", "1", events...)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected ok, got %v: %v", w.Code, w.Body)
+	}
+
+	texts := sentTexts(t, lnd, 2)
+	expected := []string{"* @alice:test waves", "hello"}
+	if !reflect.DeepEqual(texts, expected) {
+		t.Fatalf("expected %q, got %q", expected, texts)
+	}
+	expectNoPayment(t, lnd)
+
+	// A retried transaction is acknowledged, but not relayed again.
+	w = putTransaction(b, http.MethodPut, "hs_token", "1", events...)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected ok, got %v", w.Code)
+	}
+	expectNoPayment(t, lnd)
+}
+
+func TestMatrixTransactionLimit(t *testing.T) {
+	b := &matrixBridge{
+		txns: make(map[string]struct{}),
+	}
+
+	for i := 0; i < matrixMaxTxns+10; i++ {
+		if b.seenTxn(fmt.Sprint(i)) {
+			t.Fatalf("transaction %v seen before", i)
+		}
+	}
+
+	if len(b.txns) != matrixMaxTxns || len(b.txnOrder) != matrixMaxTxns {
+		t.Fatalf("expected %v remembered transactions, got %v",
+			matrixMaxTxns, len(b.txns))
+	}
+	if !b.seenTxn(fmt.Sprint(matrixMaxTxns + 9)) {
+		t.Fatalf("recent transaction forgotten")
+	}
+	if b.seenTxn("0") {
+		t.Fatalf("oldest transaction not forgotten")
+	}
+}
+
+func TestMatrixRoomMapping(t *testing.T) {
+	b, hs, _, cleanUp := testMatrixBridge(t)
+	defer cleanUp()
+
+	peer, err := route.NewVertexFromStr(testPeerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first message creates the room and invites the users.
+	for _, text := range []string{"hi", "again"} {
+		b.fromChat(&receivedMessage{
+			sender: peer,
+			text:   text,
+		})
+	}
+
+	hs.mtx.Lock()
+	rooms := hs.rooms
+	messages := hs.messages
+	hs.mtx.Unlock()
+
+	expectedRooms := map[string][]string{
+		"!room1:test": {"@alice:test"},
+	}
+	if !reflect.DeepEqual(rooms, expectedRooms) {
+		t.Fatalf("expected rooms %v, got %v", expectedRooms, rooms)
+	}
+
+	expectedMessages := []fakeMatrixMessage{
+		{"!room1:test", "m.text", "hi"},
+		{"!room1:test", "m.text", "again"},
+	}
+	if !reflect.DeepEqual(messages, expectedMessages) {
+		t.Fatalf("expected messages %v, got %v", expectedMessages,
+			messages)
+	}
+
+	if p, ok := b.rooms.peer("!room1:test"); !ok || p != peer {
+		t.Fatalf("room not mapped to peer")
+	}
+
+	// The mapping survives a restart.
+	reloaded, err := loadMatrixRooms(b.rooms.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roomID, ok := reloaded.room(peer); !ok || roomID != "!room1:test" {
+		t.Fatalf("expected !room1:test after reload, got %v", roomID)
+	}
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+	"github.com/urfave/cli"
+)
+
+var bridgeSMTPCommand = cli.Command{
+	Name:  "smtp",
+	Usage: "Exchange whatsat messages by email.",
+	Description: `
+	Run an smtp server that accepts mail addressed to
+	<pubkey_or_alias>@whatsat.local and sends the text as a whatsat message
+	to that node. Quoted text and signatures are removed from the mail
+	body. If the body is empty, the subject is sent instead.
+
+	Incoming whatsat messages are turned into mails to --mail_to that are
+	delivered to --maildir, through the --smtp_relay server, or both. The
+	sender address of these mails is the whatsat address of the sender, so
+	that replies are sent back through the gateway.
+
+	The smtp server doesn't support authentication and should only listen
+	on localhost.`,
+	Action: actionDecorator(bridgeSMTP),
+	Flags: append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "listen",
+			Usage: "host:port to accept mail on",
+			Value: "localhost:2525",
+		},
+		cli.StringFlag{
+			Name:  "domain",
+			Usage: "mail domain of whatsat addresses",
+			Value: "whatsat.local",
+		},
+		cli.StringFlag{
+			Name:  "mail_to",
+			Usage: "address to mail incoming messages to",
+		},
+		cli.StringFlag{
+			Name:  "maildir",
+			Usage: "maildir to deliver incoming messages to",
+		},
+		cli.StringFlag{
+			Name: "smtp_relay",
+			Usage: "host:port of the smtp server to send mails " +
+				"for incoming messages through",
+		},
+	}, bridgeFlags...),
+}
+
+// smtpBridge relays messages between mail and whatsat.
+type smtpBridge struct {
+	domain    string
+	mailTo    string
+	maildir   string
+	smtpRelay string
+
+	// mailCounter makes the file names of delivered mails unique.
+	mailCounter uint64
+}
+
+func bridgeSMTP(ctx *cli.Context) error {
+	b := &smtpBridge{
+		domain:    strings.ToLower(ctx.String("domain")),
+		mailTo:    ctx.String("mail_to"),
+		smtpRelay: ctx.String("smtp_relay"),
+	}
+
+	if ctx.IsSet("maildir") {
+		b.maildir = cleanAndExpandPath(ctx.String("maildir"))
+	}
+	if b.maildir == "" && b.smtpRelay == "" {
+		return fmt.Errorf("either maildir or smtp_relay is required")
+	}
+	if b.mailTo == "" {
+		return fmt.Errorf("mail_to is required")
+	}
+
+	conn := getClientConn(ctx, false)
+	defer conn.Close()
+
+	var err error
+	engine, err = newChatEngine(conn, int64(ctx.Uint64("amt_msat")))
+	if err != nil {
+		return err
+	}
+
+	if err := initPolicies(ctx); err != nil {
+		return err
+	}
+
+	if err := initHooks(ctx); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", ctx.String("listen"))
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	server := &smtpServer{
+		hostname: hostname,
+		acceptRcpt: func(rcpt string) error {
+			_, err := b.parseAddress(rcpt)
+			return err
+		},
+		deliver: b.fromMail,
+	}
+
+	receiveCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errChan := make(chan error, 2)
+	go func() {
+		errChan <- engine.receive(receiveCtx, b.fromChat, nil)
+	}()
+	go func() {
+		errChan <- server.serve(listener)
+	}()
+
+	fmt.Printf("Accepting mail for @%v on %v, press ctrl-c to stop\n",
+		b.domain, ctx.String("listen"))
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-errChan:
+		return err
+	case <-sigChan:
+		return nil
+	}
+}
+
+// parseAddress resolves a whatsat mail address to the node it belongs to.
+func (b *smtpBridge) parseAddress(addr string) (route.Vertex, error) {
+	i := strings.LastIndex(addr, "@")
+	if i < 0 || strings.ToLower(addr[i+1:]) != b.domain {
+		return route.Vertex{}, fmt.Errorf("not a whatsat address: %v",
+			addr)
+	}
+
+	return resolveDest(addr[:i])
+}
+
+// address returns the whatsat mail address of the node.
+func (b *smtpBridge) address(key route.Vertex) *mail.Address {
+	return &mail.Address{
+		Name:    keyToAlias[key],
+		Address: key.String() + "@" + b.domain,
+	}
+}
+
+// fromMail sends the text of a received mail to its recipients.
+func (b *smtpBridge) fromMail(env *smtpEnvelope) error {
+	text, err := mailText(env.data)
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return fmt.Errorf("empty message")
+	}
+
+	// Resolve all recipients before anything is sent. An error after the
+	// first send would make the client retry the whole mail and send it
+	// twice to the recipients that were already done.
+	dests := make([]route.Vertex, 0, len(env.to))
+	for _, rcpt := range env.to {
+		dest, err := b.parseAddress(rcpt)
+		if err != nil {
+			return err
+		}
+		dests = append(dests, dest)
+	}
+
+	// From here on the mail is accepted. Failures are reported per
+	// recipient with a notice mail.
+	for _, dest := range dests {
+		dest := dest
+		notice := func() {
+			b.deliverNotice(dest, "Message could not be "+
+				"delivered:\n\n"+text)
+		}
+
+		err := engine.send(dest, text, func(u *deliveryUpdate) {
+			if u.state == stateFailed {
+				notice()
+			}
+		})
+		if err != nil {
+			fmt.Printf("Cannot send to %v: %v\n", aliasOrKey(dest),
+				err)
+			notice()
+		}
+	}
+
+	return nil
+}
+
+// fromChat mails an incoming whatsat message.
+func (b *smtpBridge) fromChat(msg *receivedMessage) {
+	subject := "whatsat message from " + aliasOrKey(msg.sender)
+	err := b.deliverMail(msg.sender, subject, msg.text, msg.timestamp)
+	if err != nil {
+		fmt.Printf("Cannot deliver mail: %v\n", err)
+	}
+}
+
+// deliverNotice mails a notice about a failed delivery to a node.
+func (b *smtpBridge) deliverNotice(dest route.Vertex, text string) {
+	subject := "whatsat delivery to " + aliasOrKey(dest) + " failed"
+	if err := b.deliverMail(dest, subject, text, time.Now()); err != nil {
+		fmt.Printf("Cannot deliver mail: %v\n", err)
+	}
+}
+
+// deliverMail composes a mail from the node and delivers it to the maildir
+// and the smtp relay.
+func (b *smtpBridge) deliverMail(from route.Vertex, subject, text string,
+	date time.Time) error {
+
+	fromAddr := b.address(from)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %v\r\n", fromAddr)
+	fmt.Fprintf(&msg, "To: %v\r\n", b.mailTo)
+	fmt.Fprintf(&msg, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8",
+		subject))
+	fmt.Fprintf(&msg, "Date: %v\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%v.%v>\r\n", date.UnixNano(),
+		fromAddr.Address)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "Content-Transfer-Encoding: 8bit\r\n\r\n")
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	msg.WriteString(strings.Replace(text, "\n", "\r\n", -1))
+	msg.WriteString("\r\n")
+
+	if b.maildir != "" {
+		if err := b.deliverMaildir(msg.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if b.smtpRelay != "" {
+		err := smtp.SendMail(
+			b.smtpRelay, nil, fromAddr.Address,
+			[]string{b.mailTo}, msg.Bytes(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliverMaildir stores the mail in the new directory of the maildir. It is
+// written to the tmp directory first, so that mail readers never see a
+// partial mail.
+func (b *smtpBridge) deliverMaildir(msg []byte) error {
+	for _, dir := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(b.maildir, dir), 0700)
+		if err != nil {
+			return err
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	hostname = strings.Replace(hostname, "/", "_", -1)
+
+	name := fmt.Sprintf("%v.%v_%v.%v", time.Now().UnixNano(), os.Getpid(),
+		atomic.AddUint64(&b.mailCounter, 1), hostname)
+
+	tmpPath := filepath.Join(b.maildir, "tmp", name)
+	if err := ioutil.WriteFile(tmpPath, msg, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(b.maildir, "new", name))
+}
+
+// mailText extracts the text to send from a mail. Quoted text and the
+// signature are removed. The subject is used if there is no text left.
+func mailText(data []byte) (string, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	body, err := plainTextBody(
+		msg.Header.Get("Content-Type"),
+		msg.Header.Get("Content-Transfer-Encoding"), msg.Body,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	text := stripReply(body)
+	if text != "" {
+		return text, nil
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(
+		msg.Header.Get("Subject"),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(subject), nil
+}
+
+// plainTextBody returns the decoded text/plain body of a mail. For multipart
+// mails, the first text/plain part is used.
+func plainTextBody(contentType, encoding string, body io.Reader) (string,
+	error) {
+
+	mediaType := "text/plain"
+	var params map[string]string
+	if contentType != "" {
+		var err error
+		mediaType, params, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+
+			text, err := plainTextBody(
+				part.Header.Get("Content-Type"),
+				part.Header.Get("Content-Transfer-Encoding"),
+				part,
+			)
+			if err != nil {
+				return "", err
+			}
+			if text != "" {
+				return text, nil
+			}
+		}
+	}
+
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// stripReply removes quoted lines, the attribution line above them and the
+// signature from a mail body.
+func stripReply(body string) string {
+	lines := strings.Split(strings.Replace(body, "\r\n", "\n", -1), "\n")
+
+	var text []string
+	for _, line := range lines {
+		// The signature separator is "-- ", but the trailing space is
+		// often lost in transfer encodings.
+		if strings.TrimRight(line, " ") == "--" {
+			break
+		}
+
+		if strings.HasPrefix(line, ">") {
+			// Drop the "On ... wrote:" line.
+			n := len(text)
+			if n > 0 && strings.HasSuffix(
+				strings.TrimSpace(text[n-1]), "wrote:") {
+
+				text = text[:n-1]
+			}
+			continue
+		}
+
+		text = append(text, line)
+	}
+
+	return strings.TrimSpace(strings.Join(text, "\n"))
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMailText(t *testing.T) {
+	tests := []struct {
+		name     string
+		mail     string
+		expected string
+	}{
+		{
+			name: "plain",
+			mail: "Subject: hi\r\n\r\n" +
+				"hello\r\nworld\r\n",
+			expected: "hello\nworld",
+		},
+		{
+			name: "quoted printable",
+			mail: "Subject: hi\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: " +
+				"quoted-printable\r\n" +
+				"\r\n" +
+				"gr=C3=BC=C3=9Fe, a long line that is =\r\n" +
+				"wrapped\r\n",
+			expected: "grüße, a long line that is wrapped",
+		},
+		{
+			name: "base64",
+			mail: "Subject: hi\r\n" +
+				"Content-Transfer-Encoding: BASE64\r\n" +
+				"\r\n" +
+				"aGVsbG8g\r\nd29ybGQ=\r\n",
+			expected: "hello world",
+		},
+		{
+			// The text part is used, even if the html part comes
+			// first.
+			name: "multipart",
+			mail: "Subject: hi\r\n" +
+				"Content-Type: multipart/alternative; " +
+				"boundary=b1\r\n" +
+				"\r\n" +
+				"--b1\r\n" +
+				"Content-Type: text/html\r\n" +
+				"\r\n" +
+				"<p>html</p>\r\n" +
+				"--b1\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"dGV4dA==\r\n" +
+				"--b1--\r\n",
+			expected: "text",
+		},
+		{
+			name: "nested multipart",
+			mail: "Subject: hi\r\n" +
+				"Content-Type: multipart/mixed; " +
+				"boundary=b1\r\n" +
+				"\r\n" +
+				"--b1\r\n" +
+				"Content-Type: multipart/alternative; " +
+				"boundary=b2\r\n" +
+				"\r\n" +
+				"--b2\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"nested\r\n" +
+				"--b2--\r\n" +
+				"--b1\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"attachment\r\n" +
+				"--b1--\r\n",
+			expected: "nested",
+		},
+		{
+			name: "reply",
+			mail: "Subject: Re: hi\r\n\r\n" +
+				"sounds good\r\n" +
+				"\r\n" +
+				"On Mon, Alice wrote:\r\n" +
+				"> hello\r\n" +
+				">> earlier\r\n" +
+				"\r\n" +
+				"-- \r\n" +
+				"Bob\r\n",
+			expected: "sounds good",
+		},
+		{
+			name: "subject fallback",
+			mail: "Subject: =?utf-8?q?gr=C3=BC=C3=9Fe?=\r\n\r\n" +
+				"> quoted only\r\n",
+			expected: "grüße",
+		},
+		{
+			name: "html only",
+			mail: "Subject: hi\r\n" +
+				"Content-Type: text/html\r\n" +
+				"\r\n" +
+				"<p>html</p>\r\n",
+			expected: "hi",
+		},
+		{
+			name:     "empty",
+			mail:     "Subject: \r\n\r\n\r\n",
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		text, err := mailText([]byte(test.mail))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if text != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.name,
+				test.expected, text)
+		}
+	}
+}
+
+func TestMailTextInvalid(t *testing.T) {
+	mails := []string{
+		"no header separator",
+		"Content-Type: text/plain; charset\r\n\r\nbody\r\n",
+		"Content-Transfer-Encoding: base64\r\n\r\n!!!\r\n",
+		"Content-Type: multipart/mixed; boundary=b1\r\n\r\n" +
+			"--b1\r\nno end\r\n",
+	}
+
+	for _, mail := range mails {
+		if _, err := mailText([]byte(mail)); err == nil {
+			t.Errorf("expected error for %q", mail)
+		}
+	}
+}
+
+func TestPlainTextBody(t *testing.T) {
+	tests := []struct {
+		contentType string
+		encoding    string
+		body        string
+		expected    string
+	}{
+		{"", "", "text", "text"},
+		{"text/plain; charset=utf-8", "7bit", "text", "text"},
+		{"TEXT/PLAIN", "Quoted-Printable", "a=3Db", "a=b"},
+		{"text/html", "", "<p>html</p>", ""},
+		{"application/pdf", "base64", "dGV4dA==", ""},
+	}
+
+	for _, test := range tests {
+		text, err := plainTextBody(
+			test.contentType, test.encoding,
+			strings.NewReader(test.body),
+		)
+		if err != nil {
+			t.Fatalf("%v: %v", test.contentType, err)
+		}
+		if text != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.contentType,
+				test.expected, text)
+		}
+	}
+}
+
+func TestStripReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "no reply",
+			body:     "\r\n  hello\r\n\r\nworld \r\n\r\n",
+			expected: "hello\n\nworld",
+		},
+		{
+			name: "quote below",
+			body: "answer\n\nOn Tue, Bob <bob@example.com> " +
+				"wrote:\n> question\n",
+			expected: "answer",
+		},
+		{
+			name: "inline quotes",
+			body: "> first\nanswer 1\n> second\n" +
+				"answer 2\n",
+			expected: "answer 1\nanswer 2",
+		},
+		{
+			// Only the line right above a quote is taken as the
+			// attribution.
+			name:     "wrote elsewhere",
+			body:     "she wrote:\nthis\n> quote\n",
+			expected: "she wrote:\nthis",
+		},
+		{
+			name:     "signature",
+			body:     "text\n-- \nBob\n> not a quote\n",
+			expected: "text",
+		},
+		{
+			name:     "signature without space",
+			body:     "text\n--\nBob\n",
+			expected: "text",
+		},
+		{
+			name:     "dashes in text",
+			body:     "a -- b\n---\nc\n",
+			expected: "a -- b\n---\nc",
+		},
+		{
+			name:     "only quotes",
+			body:     "> a\n> b\n",
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		if text := stripReply(test.body); text != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.name,
+				test.expected, text)
+		}
+	}
+}
+
+func TestFromMail(t *testing.T) {
+	lnd, cleanUp := testEngine(t)
+	defer cleanUp()
+
+	b := &smtpBridge{domain: "whatsat.local"}
+	mail := []byte("Subject: hi\r\n\r\nhello\r\n\r\n-- \r\nAlice\r\n")
+
+	// One bad recipient rejects the mail before anything is sent, so that
+	// a retry of the mail doesn't reach the other recipients twice.
+	err := b.fromMail(&smtpEnvelope{
+		from: "alice@example.com",
+		to: []string{
+			testPeerKey + "@whatsat.local",
+			"unknown@whatsat.local",
+		},
+		data: mail,
+	})
+	if err == nil {
+		t.Fatal("expected error for unknown recipient")
+	}
+	expectNoPayment(t, lnd)
+
+	// Empty mails are rejected.
+	err = b.fromMail(&smtpEnvelope{
+		to:   []string{testPeerKey + "@whatsat.local"},
+		data: []byte("Subject: \r\n\r\n> quote\r\n"),
+	})
+	if err == nil {
+		t.Fatal("expected error for empty mail")
+	}
+	expectNoPayment(t, lnd)
+
+	err = b.fromMail(&smtpEnvelope{
+		from: "alice@example.com",
+		to:   []string{testPeerKey + "@WHATSAT.local"},
+		data: mail,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts := sentTexts(t, lnd, 1); !reflect.DeepEqual(
+		texts, []string{"hello"}) {
+
+		t.Fatalf("unexpected texts %v", texts)
+	}
+	expectNoPayment(t, lnd)
+}
+
+func TestParseAddress(t *testing.T) {
+	b := &smtpBridge{domain: "whatsat.local"}
+
+	tests := []struct {
+		addr string
+		ok   bool
+	}{
+		{testPeerKey + "@whatsat.local", true},
+		{testPeerKey + "@Whatsat.Local", true},
+		{testPeerKey + "@example.com", false},
+		{testPeerKey, false},
+		{"unknown@whatsat.local", false},
+	}
+
+	for _, test := range tests {
+		dest, err := b.parseAddress(test.addr)
+		if (err == nil) != test.ok {
+			t.Fatalf("%v: unexpected result %v", test.addr, err)
+		}
+		if test.ok && dest.String() != testPeerKey {
+			t.Fatalf("%v: unexpected dest %v", test.addr, dest)
+		}
+	}
+}
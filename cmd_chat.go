@@ -1,25 +1,18 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"crypto/rand"
-	"encoding/binary"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 	"time"
 
-	"github.com/lightningnetwork/lnd/keychain"
-	"github.com/lightningnetwork/lnd/lntypes"
-
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/routing/route"
 	"google.golang.org/grpc"
 
 	"github.com/jroimartin/gocui"
-	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
-	"github.com/lightningnetwork/lnd/lnrpc/signrpc"
 	"github.com/urfave/cli"
 )
 
@@ -29,36 +22,37 @@ var chatCommand = cli.Command{
 	ArgsUsage: "recipient_pubkey",
 	Usage:     "Use lnd as a p2p messenger application.",
 	Action:    actionDecorator(chat),
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		cli.Uint64Flag{
 			Name:  "amt_msat",
 			Usage: "payment amount per chat message",
 			Value: 1000,
 		},
-	},
+		cli.Uint64Flag{
+			Name: "confirm_fee_msat",
+			Usage: "require pressing enter a second time when the " +
+				"estimated routing fee exceeds this amount " +
+				"(0 disables confirmation); in plain mode, " +
+				"such messages are not sent",
+		},
+		cli.BoolFlag{
+			Name: "plain",
+			Usage: "read messages from stdin and write messages " +
+				"and delivery updates to stdout as plain text " +
+				"instead of running the terminal interface",
+		},
+	}, paymentPolicyFlags...),
 }
 
-var byteOrder = binary.BigEndian
-
-const (
-	tlvMsgRecord    = 34349334
-	tlvSigRecord    = 34349337
-	tlvSenderRecord = 34349339
-	tlvTimeRecord   = 34349343
-
-	// TODO: Reference lnd master constant when available.
-	tlvKeySendRecord = 5482373484
-)
-
-type messageState uint8
-
-const (
-	statePending messageState = iota
-
-	stateDelivered
-
-	stateFailed
-)
+// routeEstimate is the result of probing a route to a destination before a
+// message is sent to it.
+type routeEstimate struct {
+	dest route.Vertex
+	amt  int64
+	fee  int64
+	hops int
+	err  error
+}
 
 type chatLine struct {
 	text      string
@@ -67,17 +61,41 @@ type chatLine struct {
 	state     messageState
 	fee       uint64
 	timestamp time.Time
+
+	// route is the route that delivered the message. It is only set for
+	// sent messages that were delivered.
+	route *lnrpc.Route
+
+	// attempts is the number of htlc attempts made to deliver the message.
+	attempts int
+
+	// deliveryTime is the time it took from starting the payment until
+	// its final outcome was known.
+	deliveryTime time.Duration
 }
 
 var (
-	msgLines       []chatLine
-	destination    *route.Vertex
-	runningBalance map[route.Vertex]int64 = make(map[route.Vertex]int64)
+	msgLines    []chatLine
+	destination *route.Vertex
+
+	// engine sends and receives the messages of the chat.
+	engine *chatEngine
 
 	keyToAlias = make(map[route.Vertex]string)
 	aliasToKey = make(map[string]route.Vertex)
 
 	self route.Vertex
+
+	// estimate holds the last fee estimate for the active destination.
+	estimate *routeEstimate
+
+	// confirmMsg is the message that is waiting for a second enter
+	// press because its estimated fee exceeds the confirmation threshold
+	// or is unknown.
+	confirmMsg string
+
+	// confirmReason tells why confirmMsg is held back.
+	confirmReason string
 )
 
 func initAliasMaps(conn *grpc.ClientConn) error {
@@ -91,6 +109,26 @@ func initAliasMaps(conn *grpc.ClientConn) error {
 		return err
 	}
 
+	if err := addAliases(graph); err != nil {
+		return err
+	}
+
+	info, err := client.GetInfo(context.Background(), &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return err
+	}
+
+	self, err = route.NewVertexFromStr(info.IdentityPubkey)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addAliases adds the aliases of all nodes in the graph to the alias maps.
+// Aliases that aren't unique get a pubkey prefix appended.
+func addAliases(graph *lnrpc.ChannelGraph) error {
 	aliasCount := make(map[string]int)
 	for _, node := range graph.Nodes {
 		alias := node.Alias
@@ -115,57 +153,86 @@ func initAliasMaps(conn *grpc.ClientConn) error {
 		keyToAlias[key] = alias
 	}
 
-	info, err := client.GetInfo(context.Background(), &lnrpc.GetInfoRequest{})
-	if err != nil {
-		return err
-	}
-
-	self, err = route.NewVertexFromStr(info.IdentityPubkey)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
 func setDest(destStr string) {
-	dest, err := route.NewVertexFromStr(destStr)
+	dest, err := resolveDest(destStr)
 	if err == nil {
 		destination = &dest
 	}
+}
 
-	if dest, ok := aliasToKey[destStr]; ok {
-		destination = &dest
+// estimateRoute queries lnd for a route to the destination and returns the
+// fee and number of hops that sending the amount is expected to take.
+func estimateRoute(client lnrpc.LightningClient, dest route.Vertex,
+	amt, feeLimit int64) *routeEstimate {
+
+	estimate := &routeEstimate{
+		dest: dest,
+		amt:  amt,
+	}
+
+	req := &lnrpc.QueryRoutesRequest{
+		PubKey:         dest.String(),
+		AmtMsat:        amt,
+		FinalCltvDelta: 40,
+		FeeLimit: &lnrpc.FeeLimit{
+			Limit: &lnrpc.FeeLimit_FixedMsat{
+				FixedMsat: feeLimit,
+			},
+		},
+		UseMissionControl: true,
+	}
+	getPolicy(dest).applyQuery(req)
+
+	resp, err := client.QueryRoutes(context.Background(), req)
+	if err != nil {
+		estimate.err = err
+		return estimate
 	}
+	if len(resp.Routes) == 0 {
+		estimate.err = fmt.Errorf("no route found")
+		return estimate
+	}
+
+	r := resp.Routes[0]
+	estimate.fee = r.TotalFeesMsat
+	estimate.hops = len(r.Hops)
+
+	return estimate
 }
 
 func chat(ctx *cli.Context) error {
 	chatMsgAmt := int64(ctx.Uint64("amt_msat"))
+	confirmFee := int64(ctx.Uint64("confirm_fee_msat"))
 
 	conn := getClientConn(ctx, false)
 	defer conn.Close()
 
-	err := initAliasMaps(conn)
+	var err error
+	engine, err = newChatEngine(conn, chatMsgAmt)
 	if err != nil {
 		return err
 	}
 
-	if ctx.NArg() != 0 {
-		destStr := ctx.Args().First()
-		setDest(destStr)
+	if err := initPolicies(ctx); err != nil {
+		return err
 	}
 
-	mainRpc := lnrpc.NewLightningClient(conn)
-	client := routerrpc.NewRouterClient(conn)
-	signClient := signrpc.NewSignerClient(conn)
-
-	req := &lnrpc.InvoiceSubscription{}
-	rpcCtx := context.Background()
-	stream, err := mainRpc.SubscribeInvoices(rpcCtx, req)
-	if err != nil {
+	if err := initHooks(ctx); err != nil {
 		return err
 	}
 
+	destStr := ctx.Args().First()
+	if destStr != "" {
+		setDest(destStr)
+	}
+
+	if ctx.Bool("plain") {
+		return chatPlain(os.Stdin, os.Stdout, destStr, confirmFee)
+	}
+
 	g, err := gocui.NewGui(gocui.OutputNormal)
 	if err != nil {
 		log.Panicln(err)
@@ -178,143 +245,163 @@ func chat(ctx *cli.Context) error {
 		log.Panicln(err)
 	}
 
-	addMsg := func(line chatLine) int {
-		msgLines = append(msgLines, line)
-		return len(msgLines) - 1
-	}
-
-	sendMessage := func(g *gocui.Gui, v *gocui.View) error {
-		if len(v.BufferLines()) == 0 {
-			return nil
+	// updateEstimate refreshes the fee estimate for the active destination
+	// in the background. It needs to be called whenever the destination
+	// or the amount to pay changes.
+	updateEstimate := func() {
+		if destination == nil {
+			return
 		}
-		newMsg := v.BufferLines()[0]
+		d := *destination
+		payAmt := engine.payAmt(d)
 
-		v.Clear()
-		if err := v.SetCursor(0, 0); err != nil {
-			return err
+		// QueryRoutes doesn't take route hints, so there is no way to
+		// estimate the fee for destinations behind private channels.
+		if len(getRouteHints(d)) > 0 {
+			return
 		}
-		if err := v.SetOrigin(0, 0); err != nil {
-			return err
+
+		if estimate != nil && estimate.dest == d &&
+			estimate.amt == payAmt && estimate.err == nil {
+
+			return
 		}
 
-		if newMsg[0] == '/' {
-			destHex := newMsg[1:]
-			setDest(destHex)
+		go func() {
+			e := engine.estimate(d)
+			g.Update(func(g *gocui.Gui) error {
+				estimate = e
+				return updateView(g)
+			})
+		}()
+	}
+	updateEstimate()
 
-			updateView(g)
+	// needsConfirm returns why a message to the destination needs to be
+	// confirmed, or an empty string if it doesn't. Without a current
+	// estimate for the amount to pay, the fee is unknown and the message
+	// is held back as well.
+	needsConfirm := func(d route.Vertex) string {
+		switch {
+		case confirmFee == 0:
+			return ""
 
-			return nil
+		case estimate == nil || estimate.dest != d ||
+			estimate.amt != engine.payAmt(d) || estimate.err != nil:
+
+			return "fee unknown"
+
+		case estimate.fee > confirmFee:
+			return "fee above threshold"
+
+		default:
+			return ""
 		}
+	}
 
-		if destination == nil {
-			return nil
+	addMsg := func(line chatLine) int {
+		msgLines = append(msgLines, line)
+		return len(msgLines) - 1
+	}
+
+	// sendText shows an outgoing message as it is after the before_send
+	// hooks and sends it. It must be called from the gui goroutine.
+	sendText := func(d route.Vertex, text string) error {
+		sent, err := engine.beforeSend(d, text)
+
+		// A vetoed message is shown as failed instead of ending the
+		// chat.
+		if err == errVetoed {
+			addMsg(chatLine{
+				sender:    self,
+				text:      text,
+				recipient: &d,
+				state:     stateFailed,
+			})
+			return updateView(g)
+		}
+		if err != nil {
+			return err
 		}
 
-		d := *destination
 		msgIdx := addMsg(chatLine{
 			sender:    self,
-			text:      newMsg,
+			text:      sent,
 			recipient: &d,
 		})
 
-		err := updateView(g)
+		err = updateView(g)
 		if err != nil {
 			return err
 		}
 
-		payAmt := runningBalance[*destination]
-		if payAmt < chatMsgAmt {
-			payAmt = chatMsgAmt
+		return engine.deliver(d, sent, func(u *deliveryUpdate) {
+			g.Update(func(g *gocui.Gui) error {
+				line := &msgLines[msgIdx]
+				line.state = u.state
+				line.fee = uint64(u.fee)
+				line.route = u.route
+				line.deliveryTime = u.deliveryTime
+				if u.attempts > line.attempts {
+					line.attempts = u.attempts
+				}
+
+				if u.state == stateDelivered {
+					updateEstimate()
+				}
+
+				return updateView(g)
+			})
+		})
+	}
+
+	sendMessage := func(g *gocui.Gui, v *gocui.View) error {
+		if len(v.BufferLines()) == 0 {
+			return nil
 		}
-		if payAmt > 10*chatMsgAmt {
-			payAmt = 10 * chatMsgAmt
+		newMsg := v.BufferLines()[0]
+		if newMsg == "" {
+			return nil
 		}
 
-		var preimage lntypes.Preimage
-		if _, err := rand.Read(preimage[:]); err != nil {
-			return err
+		// Hold back the message if the estimated fee is too high or
+		// unknown and the user didn't confirm yet by pressing enter
+		// again.
+		if newMsg[0] != '/' && destination != nil && newMsg != confirmMsg {
+			reason := needsConfirm(*destination)
+			if reason != "" {
+				confirmMsg = newMsg
+				confirmReason = reason
+				updateEstimate()
+				return updateView(g)
+			}
 		}
-		hash := preimage.Hash()
+		confirmMsg = ""
+		confirmReason = ""
 
-		// Message sending time stamp
-		timestamp := time.Now().UnixNano()
-		var timeBuffer [8]byte
-		byteOrder.PutUint64(timeBuffer[:], uint64(timestamp))
-
-		// Sign all data.
-		signData, err := getSignData(
-			self, *destination, timeBuffer[:], []byte(newMsg),
-		)
-		if err != nil {
+		v.Clear()
+		if err := v.SetCursor(0, 0); err != nil {
 			return err
 		}
-
-		signResp, err := signClient.SignMessage(context.Background(), &signrpc.SignMessageReq{
-			Msg: signData,
-			KeyLoc: &signrpc.KeyLocator{
-				KeyFamily: int32(keychain.KeyFamilyNodeKey),
-				KeyIndex:  0,
-			},
-		})
-		if err != nil {
+		if err := v.SetOrigin(0, 0); err != nil {
 			return err
 		}
-		signature := signResp.Signature
-
-		customRecords := map[uint64][]byte{
-			tlvMsgRecord:     []byte(newMsg),
-			tlvSenderRecord:  self[:],
-			tlvTimeRecord:    timeBuffer[:],
-			tlvSigRecord:     signature,
-			tlvKeySendRecord: preimage[:],
-		}
-
-		req := routerrpc.SendPaymentRequest{
-			PaymentHash:       hash[:],
-			AmtMsat:           payAmt,
-			FinalCltvDelta:    40,
-			Dest:              destination[:],
-			FeeLimitMsat:      chatMsgAmt * 10,
-			TimeoutSeconds:    30,
-			DestCustomRecords: customRecords,
-		}
-
-		go func() {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			stream, err := client.SendPayment(ctx, &req)
-			if err != nil {
-				g.Update(func(g *gocui.Gui) error {
-					return err
-				})
-				return
-			}
 
-			for {
-				status, err := stream.Recv()
-				if err != nil {
-					break
-				}
+		if newMsg[0] == '/' {
+			destHex := newMsg[1:]
+			setDest(destHex)
 
-				switch status.State {
-				case routerrpc.PaymentState_SUCCEEDED:
-					msgLines[msgIdx].fee = uint64(status.Route.TotalFeesMsat)
-					runningBalance[*destination] -= payAmt
-					msgLines[msgIdx].state = stateDelivered
-					g.Update(updateView)
-					break
+			updateEstimate()
+			updateView(g)
 
-				case routerrpc.PaymentState_IN_FLIGHT:
+			return nil
+		}
 
-				default:
-					msgLines[msgIdx].state = stateFailed
-					g.Update(updateView)
-					break
-				}
-			}
-		}()
+		if destination == nil {
+			return nil
+		}
 
-		return nil
+		return sendText(*destination, newMsg)
 	}
 
 	err = g.SetKeybinding("send", gocui.KeyEnter, gocui.ModNone, sendMessage)
@@ -322,100 +409,40 @@ func chat(ctx *cli.Context) error {
 		return err
 	}
 
-	go func() {
-		returnErr := func(err error) {
-			g.Update(func(g *gocui.Gui) error {
-				return err
-			})
-		}
-
-		for {
-			invoice, err := stream.Recv()
-			if err != nil {
-				returnErr(err)
-				return
-			}
-
-			if invoice.State != lnrpc.Invoice_SETTLED {
-				continue
-			}
-
-			var customRecords map[uint64][]byte
-			for _, htlc := range invoice.Htlcs {
-				if htlc.State == lnrpc.InvoiceHTLCState_SETTLED {
-					customRecords = htlc.CustomRecords
-					break
-				}
-			}
-			if customRecords == nil {
-				continue
-			}
-
-			msg, ok := customRecords[tlvMsgRecord]
-			if !ok {
-				continue
-			}
-
-			signature, ok := customRecords[tlvSigRecord]
-			if !ok {
-				continue
-			}
-
-			timestampBytes, ok := customRecords[tlvTimeRecord]
-			if !ok {
-				continue
-			}
-			timestamp := time.Unix(
-				0,
-				int64(byteOrder.Uint64(timestampBytes)),
-			)
-
-			senderBytes, ok := customRecords[tlvSenderRecord]
-			if !ok {
-				continue
-			}
-			sender, err := route.NewVertexFromBytes(senderBytes)
-			if err != nil {
-				// Invalid sender pubkey
-				continue
-			}
-
-			signData, err := getSignData(sender, self, timestampBytes, msg)
-			if err != nil {
-				returnErr(err)
-				return
-			}
+	if err := setRouteKeybindings(g); err != nil {
+		return err
+	}
 
-			verifyResp, err := signClient.VerifyMessage(
-				context.Background(),
-				&signrpc.VerifyMessageReq{
-					Msg:       signData,
-					Signature: signature,
-					Pubkey:    sender[:],
+	go func() {
+		err := engine.receive(
+			context.Background(), func(msg *receivedMessage) {
+				g.Update(func(g *gocui.Gui) error {
+					if destination == nil {
+						sender := msg.sender
+						destination = &sender
+					}
+
+					addMsg(chatLine{
+						sender:    msg.sender,
+						text:      msg.text,
+						timestamp: msg.timestamp,
+					})
+
+					updateEstimate()
+					return updateView(g)
 				})
-			if err != nil {
-				returnErr(err)
-				return
-			}
-
-			if !verifyResp.Valid {
-				continue
-			}
-
-			if destination == nil {
-				destination = &sender
-			}
-
-			addMsg(chatLine{
-				sender:    sender,
-				text:      string(msg),
-				timestamp: timestamp,
-			})
-			g.Update(updateView)
+			},
+			func(dest route.Vertex, text string) error {
+				g.Update(func(g *gocui.Gui) error {
+					return sendText(dest, text)
+				})
+				return nil
+			},
+		)
 
-			amt := invoice.AmtPaid
-			runningBalance[*destination] += amt
-		}
+		g.Update(func(g *gocui.Gui) error {
+			return err
+		})
 	}()
 
 	if err := g.MainLoop(); err != nil && err != gocui.ErrQuit {
@@ -448,6 +475,10 @@ func layout(g *gocui.Gui) error {
 		v.Editable = true
 	}
 
+	if err := layoutRouteView(g); err != nil {
+		return err
+	}
+
 	updateView(g)
 
 	return nil
@@ -468,7 +499,23 @@ func updateView(g *gocui.Gui) error {
 	} else {
 		alias := keyToAlias[*destination]
 		sendView.Title = fmt.Sprintf(" Send to %v [balance: %v msat]",
-			alias, runningBalance[*destination])
+			alias, engine.balance(*destination))
+
+		if estimate != nil && estimate.dest == *destination {
+			if estimate.err != nil {
+				sendView.Title += " [no route] "
+			} else {
+				sendView.Title += fmt.Sprintf(
+					" [est. fee: %v msat, %v hops] ",
+					estimate.fee, estimate.hops,
+				)
+			}
+		}
+
+		if confirmMsg != "" {
+			sendView.Title += "- " + confirmReason + ", press " +
+				"enter again to send "
+		}
 	}
 
 	messagesView, _ := g.View("messages")
@@ -529,6 +576,9 @@ func updateView(g *gocui.Gui) error {
 
 		fmt.Fprintln(messagesView)
 	}
+
+	updateRouteView(g)
+
 	return nil
 }
 
@@ -544,29 +594,3 @@ func formatMsat(msat uint64) string {
 		wholeSats, msatsStr,
 	)
 }
-
-func getSignData(sender, recipient route.Vertex, timestamp []byte, msg []byte) ([]byte, error) {
-	var signData bytes.Buffer
-
-	// Write sender.
-	if _, err := signData.Write(sender[:]); err != nil {
-		return nil, err
-	}
-
-	// Write recipient.
-	if _, err := signData.Write(recipient[:]); err != nil {
-		return nil, err
-	}
-
-	// Write time.
-	if _, err := signData.Write(timestamp); err != nil {
-		return nil, err
-	}
-
-	// Write message.
-	if _, err := signData.Write(msg); err != nil {
-		return nil, err
-	}
-
-	return signData.Bytes(), nil
-}
@@ -1,13 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/csv"
 	"fmt"
-	"net/http"
-	"sort"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/urfave/cli"
@@ -18,12 +19,89 @@ var chatPeersCommand = cli.Command{
 	Category: "Chat",
 	Usage:    "Show recommended peers to connect to for chatting.",
 	Action:   actionDecorator(chatPeers),
+	Flags: append([]cli.Flag{
+		cli.Uint64Flag{
+			Name:  "amt_msat",
+			Usage: "chat payment amount to calculate fees for",
+			Value: 1000,
+		},
+		cli.StringFlag{
+			Name: "source",
+			Usage: "where to get candidate peers from: bos (the " +
+				"bos list), file (a local json or csv file) " +
+				"or graph (all nodes in the graph)",
+			Value: "bos",
+		},
+		cli.StringFlag{
+			Name: "source_file",
+			Usage: "path of the candidates file for the file " +
+				"source; json in the bos list format or csv " +
+				"with pubkey,alias records",
+		},
+		cli.DurationFlag{
+			Name: "cache_max_age",
+			Usage: "maximum age of the cached bos list before it " +
+				"is fetched again (0 disables the cache)",
+			Value: 24 * time.Hour,
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the peers as json",
+		},
+		cli.BoolFlag{
+			Name:  "csv",
+			Usage: "print the peers as csv",
+		},
+		cli.IntFlag{
+			Name:  "limit",
+			Usage: "maximum number of peers to show (0 shows all)",
+		},
+		cli.Int64Flag{
+			Name: "max_fee_msat",
+			Usage: "only show peers that forward the chat amount " +
+				"for at most this fee (-1 disables the filter)",
+			Value: -1,
+		},
+		cli.BoolFlag{
+			Name: "open",
+			Usage: "interactively select a peer, connect to it and " +
+				"open a channel with a chat-friendly policy",
+		},
+		cli.BoolFlag{
+			Name: "dry_run",
+			Usage: "with --open, only show what would be done " +
+				"without connecting or opening a channel",
+		},
+		cli.Int64Flag{
+			Name:  "chan_size",
+			Usage: "with --open, the size in sat of the new channel",
+			Value: 100000,
+		},
+	}, chatPolicyFlags...),
+}
+
+// chatPeer is the output format of a recommended peer.
+type chatPeer struct {
+	Node      string `json:"node"`
+	Alias     string `json:"alias"`
+	FeeMsat   int64  `json:"fee_msat"`
+	Forwards  bool   `json:"forwards"`
+	MinHtlc   int64  `json:"min_htlc_msat"`
+	Channels  int    `json:"channels"`
+	Capacity  int64  `json:"capacity_sat"`
+	Reachable bool   `json:"reachable"`
+	Connected bool   `json:"connected"`
 }
 
 func chatPeers(ctx *cli.Context) error {
 	network := strings.ToLower(ctx.GlobalString("network"))
+	amtMsat := int64(ctx.Uint64("amt_msat"))
+
+	if ctx.Bool("json") && ctx.Bool("csv") {
+		return fmt.Errorf("json and csv output can't be combined")
+	}
 
-	bosNodes, err := getBosNodes(network)
+	source, err := getCandidateSource(ctx, network)
 	if err != nil {
 		return err
 	}
@@ -41,105 +119,193 @@ func chatPeers(ctx *cli.Context) error {
 		return err
 	}
 
-	type bestPolicy struct {
-		fee     int64
-		minHtlc int64
+	info, err := client.GetInfo(
+		context.Background(), &lnrpc.GetInfoRequest{},
+	)
+	if err != nil {
+		return err
 	}
 
-	lowestFee := make(map[string]bestPolicy)
-	for _, u := range graph.Edges {
-		process := func(key string, p *lnrpc.RoutingPolicy) {
-			if p == nil {
-				return
-			}
-			amt := p.MinHtlc
-			fee := p.FeeBaseMsat + amt*p.FeeRateMilliMsat/1000000
-
-			lowest, ok := lowestFee[key]
-			if !ok || fee > lowest.fee {
-				lowest = bestPolicy{
-					fee: fee,
-				}
-				lowestFee[key] = lowest
-			}
-			if p.MinHtlc > lowest.minHtlc {
-				lowest.minHtlc = p.MinHtlc
-				lowestFee[key] = lowest
-			}
-		}
+	peers, err := client.ListPeers(
+		context.Background(), &lnrpc.ListPeersRequest{},
+	)
+	if err != nil {
+		return err
+	}
 
-		process(u.Node1Pub, u.Node1Policy)
-		process(u.Node2Pub, u.Node2Policy)
+	connected := make(map[string]bool)
+	for _, peer := range peers.Peers {
+		connected[peer.PubKey] = true
 	}
 
-	type nodeFee struct {
-		node  string
-		alias string
-		fee   bestPolicy
+	candidates, err := source.candidates(graph)
+	if err != nil {
+		return err
 	}
 
-	list := make([]nodeFee, 0)
-	for n, f := range lowestFee {
-		alias, ok := bosNodes[n]
-		if !ok {
+	scores := scorePeers(graph, info.IdentityPubkey, amtMsat)
+
+	maxFee := ctx.Int64("max_fee_msat")
+
+	list := make([]*peerScore, 0)
+	for n, score := range scores {
+		alias, ok := candidates[n]
+		if !ok || n == info.IdentityPubkey {
 			continue
 		}
-		list = append(list, nodeFee{
-			node:  n,
-			fee:   f,
-			alias: alias,
-		})
+		if alias != "" {
+			score.alias = alias
+		}
+		if maxFee >= 0 && (!score.compatible || score.fee > maxFee) {
+			continue
+		}
+		list = append(list, score)
 	}
 
-	sort.Slice(list, func(i, j int) bool {
-		return list[i].fee.fee < list[j].fee.fee || (list[i].fee.fee == list[j].fee.fee && list[i].fee.minHtlc < list[j].fee.minHtlc)
-	})
+	rankPeers(list)
 
+	// Keep the selection list manageable when opening a channel.
+	limit := ctx.Int("limit")
+	if limit == 0 && ctx.Bool("open") {
+		limit = 20
+	}
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+
+	result := make([]chatPeer, 0, len(list))
 	for _, item := range list {
-		fmt.Printf("%v (%v) %v msat (min_htlc %v msat)\n", item.node, item.alias, item.fee.fee, item.fee.minHtlc)
+		result = append(result, chatPeer{
+			Node:      item.node,
+			Alias:     item.alias,
+			FeeMsat:   item.fee,
+			Forwards:  item.compatible,
+			MinHtlc:   item.minHtlc,
+			Channels:  item.channels,
+			Capacity:  item.capacity,
+			Reachable: item.reachable,
+			Connected: connected[item.node],
+		})
+	}
+
+	switch {
+	case ctx.Bool("open"):
+		return openChatChannel(ctx, client, result)
+
+	case ctx.Bool("json"):
+		printJSON(result)
+
+	case ctx.Bool("csv"):
+		return printChatPeersCSV(result)
+
+	default:
+		printChatPeers(result, amtMsat)
 	}
 
 	return nil
 }
 
-type BosScore struct {
-	Alias     string
-	PublicKey string `json:"public_key"`
-}
+// printChatPeers prints the peers in a human readable format.
+func printChatPeers(peers []chatPeer, amtMsat int64) {
+	for _, item := range peers {
+		var connected string
+		if item.Connected {
+			connected = ", connected"
+		}
 
-type BosList struct {
-	Scores []*BosScore
-}
+		if !item.Forwards {
+			fmt.Printf("%v (%v) doesn't forward %v msat "+
+				"(min_htlc %v msat%v)\n", item.Node, item.Alias,
+				amtMsat, item.MinHtlc, connected)
+			continue
+		}
 
-func getBosNodes(network string) (map[string]string, error) {
-	var url string
-	switch network {
-	case "mainnet":
-		url = "https://nodes.lightning.computer/availability/v1/btc.json"
-	case "testnet":
-		url = "https://nodes.lightning.computer/availability/v1/btctestnet.json"
-	default:
-		return nil, fmt.Errorf("no bos list for network %v", network)
+		var unreachable string
+		if !item.Reachable {
+			unreachable = ", unreachable"
+		}
+
+		fmt.Printf("%v (%v) %v msat (min_htlc %v msat, %v channels, "+
+			"%v sat capacity%v%v)\n", item.Node, item.Alias,
+			item.FeeMsat, item.MinHtlc, item.Channels,
+			item.Capacity, unreachable, connected)
 	}
+}
+
+// printChatPeersCSV prints the peers as csv with a header line.
+func printChatPeersCSV(peers []chatPeer) error {
+	w := csv.NewWriter(os.Stdout)
 
-	resp, err := http.Get(url)
+	err := w.Write([]string{
+		"node", "alias", "fee_msat", "forwards", "min_htlc_msat",
+		"channels", "capacity_sat", "reachable", "connected",
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	defer resp.Body.Close()
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(resp.Body)
-	respByte := buf.Bytes()
-
-	var bosList BosList
-	if err := json.Unmarshal(respByte, &bosList); err != nil {
-		return nil, err
+	for _, item := range peers {
+		err := w.Write([]string{
+			item.Node,
+			item.Alias,
+			strconv.FormatInt(item.FeeMsat, 10),
+			strconv.FormatBool(item.Forwards),
+			strconv.FormatInt(item.MinHtlc, 10),
+			strconv.Itoa(item.Channels),
+			strconv.FormatInt(item.Capacity, 10),
+			strconv.FormatBool(item.Reachable),
+			strconv.FormatBool(item.Connected),
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	bosNodes := make(map[string]string)
-	for _, item := range bosList.Scores {
-		bosNodes[item.PublicKey] = item.Alias
+	w.Flush()
+	return w.Error()
+}
+
+// getCandidateSource returns the candidate source selected on the command
+// line.
+func getCandidateSource(ctx *cli.Context, network string) (candidateSource,
+	error) {
+
+	switch ctx.String("source") {
+	case "bos":
+		var source candidateSource = &bosSource{
+			network: network,
+		}
+
+		maxAge := ctx.Duration("cache_max_age")
+		if maxAge > 0 {
+			source = &cachedSource{
+				source: source,
+				path: filepath.Join(
+					getDataDir(ctx), "cache",
+					"bos_"+network+".json",
+				),
+				maxAge: maxAge,
+			}
+		}
+
+		return source, nil
+
+	case "file":
+		path := ctx.String("source_file")
+		if path == "" {
+			return nil, fmt.Errorf("source_file must be set for " +
+				"the file source")
+		}
+
+		return &fileSource{
+			path: cleanAndExpandPath(path),
+		}, nil
+
+	case "graph":
+		return &graphSource{}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown candidate source: %v",
+			ctx.String("source"))
 	}
-	return bosNodes, nil
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/urfave/cli"
+)
+
+// openChatChannel lets the user pick one of the ranked peers, connects to it,
+// opens a channel and sets a chat-friendly policy on the new channel.
+func openChatChannel(ctx *cli.Context, client lnrpc.LightningClient,
+	peers []chatPeer) error {
+
+	if len(peers) == 0 {
+		return fmt.Errorf("no candidate peers")
+	}
+
+	for i, item := range peers {
+		var connected string
+		if item.Connected {
+			connected = ", connected"
+		}
+		fmt.Printf("%3d. %v (%v) %v msat (%v channels%v)\n", i+1,
+			item.Node, item.Alias, item.FeeMsat, item.Channels,
+			connected)
+	}
+
+	fmt.Print("\nSelect a peer to open a channel to (empty to abort): ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+
+	idx, err := strconv.Atoi(line)
+	if err != nil || idx < 1 || idx > len(peers) {
+		return fmt.Errorf("invalid selection: %v", line)
+	}
+	peer := peers[idx-1]
+
+	dryRun := ctx.Bool("dry_run")
+	chanSize := ctx.Int64("chan_size")
+	policy := getChatPolicy(ctx)
+	ctxb := context.Background()
+
+	if !peer.Connected {
+		nodeInfo, err := client.GetNodeInfo(ctxb, &lnrpc.NodeInfoRequest{
+			PubKey: peer.Node,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := connectPeer(client, nodeInfo, dryRun); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Opening %v sat channel to %v\n", chanSize, peer.Node)
+	if dryRun {
+		fmt.Printf("Setting policy on the new channel: %v\n", policy)
+		return nil
+	}
+
+	chanPoint, err := client.OpenChannelSync(ctxb, &lnrpc.OpenChannelRequest{
+		NodePubkeyString:   peer.Node,
+		LocalFundingAmount: chanSize,
+		MinHtlcMsat:        int64(policy.minHtlcMsat),
+	})
+	if err != nil {
+		return err
+	}
+
+	chanPointStr, err := formatChanPoint(chanPoint)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Channel %v pending, waiting for it to open. Press ctrl-c "+
+		"to stop waiting, the policy can also be set later with "+
+		"'whatsat chatpolicy --apply'.\n", chanPointStr)
+
+	if err := waitForChannelOpen(client, chanPointStr); err != nil {
+		return err
+	}
+
+	fmt.Printf("Setting policy on the new channel: %v\n", policy)
+	_, err = client.UpdateChannelPolicy(
+		ctxb, policy.updateRequest(chanPoint),
+	)
+	return err
+}
+
+// connectPeer connects to the first address of the node that accepts the
+// connection.
+func connectPeer(client lnrpc.LightningClient, nodeInfo *lnrpc.NodeInfo,
+	dryRun bool) error {
+
+	node := nodeInfo.Node
+	if len(node.Addresses) == 0 {
+		return fmt.Errorf("no known address for %v", node.PubKey)
+	}
+
+	var err error
+	for _, addr := range node.Addresses {
+		fmt.Printf("Connecting to %v@%v\n", node.PubKey, addr.Addr)
+		if dryRun {
+			return nil
+		}
+
+		_, err = client.ConnectPeer(
+			context.Background(), &lnrpc.ConnectPeerRequest{
+				Addr: &lnrpc.LightningAddress{
+					Pubkey: node.PubKey,
+					Host:   addr.Addr,
+				},
+				Perm: true,
+			},
+		)
+		if err == nil {
+			return nil
+		}
+		fmt.Printf("Unable to connect: %v\n", err)
+	}
+
+	return err
+}
+
+// waitForChannelOpen blocks until lnd reports the channel as open.
+func waitForChannelOpen(client lnrpc.LightningClient, chanPoint string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.SubscribeChannelEvents(
+		ctx, &lnrpc.ChannelEventSubscription{},
+	)
+	if err != nil {
+		return err
+	}
+
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		if event.Type != lnrpc.ChannelEventUpdate_OPEN_CHANNEL {
+			continue
+		}
+
+		if event.GetOpenChannel().ChannelPoint == chanPoint {
+			return nil
+		}
+	}
+}
+
+// formatChanPoint returns the txid:index notation of a channel point.
+func formatChanPoint(chanPoint *lnrpc.ChannelPoint) (string, error) {
+	txid := chanPoint.GetFundingTxidStr()
+	if txid == "" {
+		hash, err := chainhash.NewHash(chanPoint.GetFundingTxidBytes())
+		if err != nil {
+			return "", err
+		}
+		txid = hash.String()
+	}
+
+	return fmt.Sprintf("%v:%v", txid, chanPoint.OutputIndex), nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+// plainChat is the chat without the terminal interface. Lines that are read
+// from the input are sent as messages, incoming messages and delivery updates
+// are written to the output as plain text lines.
+type plainChat struct {
+	out io.Writer
+
+	// confirmFee is the fee in msat above which typed messages are not
+	// sent, because there is no way to confirm them. Zero disables the
+	// check.
+	confirmFee int64
+
+	// mtx serializes the output and protects the destination, which is
+	// also set by incoming messages.
+	mtx sync.Mutex
+
+	// msgCount numbers the sent messages, so that delivery updates can be
+	// matched with them.
+	msgCount int
+
+	// pending tracks the messages that are still being delivered.
+	pending sync.WaitGroup
+}
+
+// chatPlain runs the chat in plain mode until the input ends and all sent
+// messages are delivered or failed.
+func chatPlain(in io.Reader, out io.Writer, destStr string,
+	confirmFee int64) error {
+
+	c := &plainChat{
+		out:        out,
+		confirmFee: confirmFee,
+	}
+
+	if destStr != "" && destination == nil {
+		c.printf("* unknown destination: %v", destStr)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- engine.receive(
+			context.Background(), c.receive, c.reply,
+		)
+	}()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				c.pending.Wait()
+				return nil
+			}
+
+			c.handleLine(line)
+
+		case err := <-errChan:
+			return err
+		}
+	}
+}
+
+// handleLine sends a line of input as message, or changes the destination
+// when the line starts with a slash.
+func (c *plainChat) handleLine(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	d, ok := c.lineDest(line)
+	if !ok {
+		return
+	}
+
+	// The fee is estimated without holding the mutex, so that incoming
+	// messages are still written in the meantime.
+	feeErr := c.checkFee(d)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.send(d, line, feeErr)
+}
+
+// lineDest returns the destination to send a line of input to. Lines that
+// start with a slash change the destination and aren't sent.
+func (c *plainChat) lineDest(line string) (route.Vertex, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if line[0] == '/' {
+		dest, err := resolveDest(line[1:])
+		if err != nil {
+			c.printf("* %v", err)
+			return route.Vertex{}, false
+		}
+
+		destination = &dest
+		c.printf("* destination %v", aliasOrKey(dest))
+		return route.Vertex{}, false
+	}
+
+	if destination == nil {
+		c.printf("* no destination, type /<pubkey_or_alias> first")
+		return route.Vertex{}, false
+	}
+
+	return *destination, true
+}
+
+// checkFee returns an error if the estimated fee to the destination exceeds
+// the confirmation threshold or is unknown. The terminal interface asks for a
+// confirmation in these cases, but plain mode has no way to ask.
+func (c *plainChat) checkFee(d route.Vertex) error {
+	if c.confirmFee == 0 {
+		return nil
+	}
+
+	// QueryRoutes doesn't take route hints, so there is no way to
+	// estimate the fee for destinations behind private channels.
+	if len(getRouteHints(d)) > 0 {
+		return fmt.Errorf("fee unknown for a destination with " +
+			"route hints")
+	}
+
+	estimate := engine.estimate(d)
+	switch {
+	case estimate.err != nil:
+		return fmt.Errorf("fee unknown: %v", estimate.err)
+
+	case estimate.fee > c.confirmFee:
+		return fmt.Errorf("fee %v msat exceeds confirm_fee_msat %v",
+			estimate.fee, c.confirmFee)
+	}
+
+	return nil
+}
+
+// send writes an outgoing message as it is after the before_send hooks and
+// sends it, unless feeErr is set. The caller must hold the mutex.
+func (c *plainChat) send(d route.Vertex, text string, feeErr error) {
+	c.msgCount++
+	id := c.msgCount
+
+	if feeErr != nil {
+		c.printf("#%v > %v: %v", id, aliasOrKey(d), indentLines(text))
+		c.printf("* #%v not sent to %v: %v", id, aliasOrKey(d), feeErr)
+		return
+	}
+
+	sent, err := engine.beforeSend(d, text)
+	if err != nil {
+		c.printf("#%v > %v: %v", id, aliasOrKey(d), indentLines(text))
+		c.printf("* #%v failed to %v: %v", id, aliasOrKey(d), err)
+		return
+	}
+
+	c.printf("#%v > %v: %v", id, aliasOrKey(d), indentLines(sent))
+
+	c.pending.Add(1)
+	err = engine.deliver(d, sent, func(u *deliveryUpdate) {
+		if u.state == statePending {
+			return
+		}
+		defer c.pending.Done()
+
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+
+		if u.state == stateDelivered {
+			c.printf("* #%v delivered to %v, fee %v msat, %v",
+				id, aliasOrKey(d), u.fee,
+				u.deliveryTime.Round(time.Millisecond))
+			return
+		}
+
+		c.printf("* #%v failed to %v", id, aliasOrKey(d))
+	})
+	if err != nil {
+		c.pending.Done()
+		c.printf("* #%v failed to %v: %v", id, aliasOrKey(d), err)
+	}
+}
+
+// reply writes and sends a reply of a hook. Like in the terminal interface,
+// replies aren't held back by the confirmation threshold.
+func (c *plainChat) reply(dest route.Vertex, text string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.send(dest, text, nil)
+	return nil
+}
+
+// receive writes an incoming message. The sender becomes the destination if
+// there is none yet.
+func (c *plainChat) receive(msg *receivedMessage) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if destination == nil {
+		sender := msg.sender
+		destination = &sender
+	}
+
+	c.printf("%v: %v", aliasOrKey(msg.sender),
+		indentLines(msg.text))
+}
+
+// printf writes a line prefixed with the time. The caller must hold the mutex.
+func (c *plainChat) printf(format string, args ...interface{}) {
+	fmt.Fprintf(c.out, "%v %v\n", time.Now().Format("15:04:05"),
+		fmt.Sprintf(format, args...))
+}
+
+// indentLines indents all but the first line of a multi-line message, so that
+// continuation lines can be told apart from new output lines.
+func indentLines(text string) string {
+	return strings.Replace(text, "\n", "\n\t", -1)
+}
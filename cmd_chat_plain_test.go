@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPlainChatConfirmFee(t *testing.T) {
+	lnd, cleanUp := testEngine(t)
+	defer cleanUp()
+	defer func() {
+		destination = nil
+	}()
+
+	tests := []struct {
+		name       string
+		input      string
+		routeFee   int64
+		confirmFee int64
+		sent       bool
+		output     string
+	}{
+		{
+			name:       "below threshold",
+			input:      "/bob\nhi\n",
+			routeFee:   100,
+			confirmFee: 100,
+			sent:       true,
+			output:     "* #1 delivered to bob",
+		},
+		{
+			name:       "above threshold",
+			input:      "/bob\nhi\n",
+			routeFee:   101,
+			confirmFee: 100,
+			output: "* #1 not sent to bob: fee 101 msat " +
+				"exceeds confirm_fee_msat 100",
+		},
+		{
+			name:       "no threshold",
+			input:      "/bob\nhi\n",
+			routeFee:   1000,
+			confirmFee: 0,
+			sent:       true,
+			output:     "* #1 delivered to bob",
+		},
+		{
+			name:       "fee unknown",
+			input:      "/self\nhi\n",
+			confirmFee: 100,
+			output:     "* #1 not sent to self: fee unknown",
+		},
+	}
+
+	for _, test := range tests {
+		destination = nil
+		atomic.StoreInt64(&lnd.routeFee, test.routeFee)
+
+		var out bytes.Buffer
+		err := chatPlain(
+			strings.NewReader(test.input), &out, "",
+			test.confirmFee,
+		)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		if !strings.Contains(out.String(), test.output) {
+			t.Fatalf("%v: %q not in output:\n%v", test.name,
+				test.output, out.String())
+		}
+
+		if test.sent {
+			texts := sentTexts(t, lnd, 1)
+			if !reflect.DeepEqual(texts, []string{"hi"}) {
+				t.Fatalf("%v: unexpected texts %v", test.name,
+					texts)
+			}
+		}
+		expectNoPayment(t, lnd)
+	}
+}
+
+func TestPlainChatMultiLine(t *testing.T) {
+	lnd, cleanUp := testEngine(t)
+	defer cleanUp()
+
+	var out bytes.Buffer
+	c := &plainChat{out: &out}
+
+	// Hook replies can span multiple lines.
+	if err := c.reply(testPeer(t), "first\nsecond"); err != nil {
+		t.Fatal(err)
+	}
+	c.pending.Wait()
+
+	sentTexts(t, lnd, 1)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "#1 > bob: first") ||
+		lines[1] != "\tsecond" {
+
+		t.Fatalf("unexpected output:\n%v", out.String())
+	}
+}
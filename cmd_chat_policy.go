@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/urfave/cli"
+)
+
+var chatPolicyCommand = cli.Command{
+	Name:     "chatpolicy",
+	Category: "Chat",
+	Usage: "Check which of our channels forward chat payments and " +
+		"optionally apply a chat-friendly policy.",
+	Description: `
+	Inspects the forwarding policies of our channels and reports the
+	channels that reject htlcs of the chat amount, because of their min or
+	max htlc setting or because they are disabled.
+
+	With --apply, the chat policy is set on those channels after
+	confirmation. Use --all to also offer the channels that already
+	forward chat payments, for example to lower their fees.`,
+	Action: actionDecorator(chatPolicy),
+	Flags: append([]cli.Flag{
+		cli.Uint64Flag{
+			Name:  "amt_msat",
+			Usage: "chat payment amount to check the channels for",
+			Value: 1000,
+		},
+		cli.BoolFlag{
+			Name:  "apply",
+			Usage: "apply the chat policy to the reported channels",
+		},
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "with --apply, offer all channels",
+		},
+		cli.BoolFlag{
+			Name:  "yes",
+			Usage: "with --apply, don't ask for confirmation",
+		},
+	}, chatPolicyFlags...),
+}
+
+func chatPolicy(ctx *cli.Context) error {
+	amtMsat := int64(ctx.Uint64("amt_msat"))
+	ctxb := context.Background()
+
+	client, cleanUp := getClient(ctx)
+	defer cleanUp()
+
+	info, err := client.GetInfo(ctxb, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return err
+	}
+
+	feeReport, err := client.FeeReport(ctxb, &lnrpc.FeeReportRequest{})
+	if err != nil {
+		return err
+	}
+	fees := make(map[string]*lnrpc.ChannelFeeReport)
+	for _, f := range feeReport.ChannelFees {
+		fees[f.ChanPoint] = f
+	}
+
+	channels, err := client.ListChannels(ctxb, &lnrpc.ListChannelsRequest{})
+	if err != nil {
+		return err
+	}
+
+	var candidates []*lnrpc.Channel
+	for _, channel := range channels.Channels {
+		edge, err := client.GetChanInfo(ctxb, &lnrpc.ChanInfoRequest{
+			ChanId: channel.ChanId,
+		})
+		if err != nil {
+			return err
+		}
+
+		policy := edge.Node1Policy
+		if edge.Node2Pub == info.IdentityPubkey {
+			policy = edge.Node2Policy
+		}
+
+		var problem string
+		switch {
+		case policy == nil:
+			problem = "no policy"
+		case policy.Disabled:
+			problem = "disabled"
+		case amtMsat < policy.MinHtlc:
+			problem = fmt.Sprintf("min_htlc %v msat too high",
+				policy.MinHtlc)
+		case policy.MaxHtlcMsat != 0 &&
+			uint64(amtMsat) > policy.MaxHtlcMsat:
+
+			problem = fmt.Sprintf("max_htlc %v msat too low",
+				policy.MaxHtlcMsat)
+		}
+
+		var baseFee, feeRate int64
+		if f, ok := fees[channel.ChannelPoint]; ok {
+			baseFee, feeRate = f.BaseFeeMsat, f.FeePerMil
+		}
+
+		status := "ok"
+		if problem != "" {
+			status = "rejects chat htlcs: " + problem
+		}
+
+		fmt.Printf("%v (%v): base fee %v msat, fee rate %v ppm",
+			channel.ChanId, channel.RemotePubkey, baseFee, feeRate)
+		if policy != nil {
+			fmt.Printf(", htlc %v-%v msat, fee at chat amount "+
+				"%v msat", policy.MinHtlc, policy.MaxHtlcMsat,
+				policyFee(policy, amtMsat))
+		}
+		fmt.Printf(" - %v\n", status)
+
+		if problem != "" || ctx.Bool("all") {
+			candidates = append(candidates, channel)
+		}
+	}
+
+	if !ctx.Bool("apply") || len(candidates) == 0 {
+		return nil
+	}
+
+	chatPolicy := getChatPolicy(ctx)
+	fmt.Printf("\nChat policy: %v\n", chatPolicy)
+
+	stdin := bufio.NewReader(os.Stdin)
+	for _, channel := range candidates {
+		if !ctx.Bool("yes") {
+			fmt.Printf("Apply to channel %v? [y/N] ", channel.ChanId)
+			answer, err := stdin.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer != "y" && answer != "yes" {
+				continue
+			}
+		}
+
+		chanPoint, err := parseChanPoint(channel.ChannelPoint)
+		if err != nil {
+			return err
+		}
+
+		_, err = client.UpdateChannelPolicy(
+			ctxb, chatPolicy.updateRequest(chanPoint),
+		)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Updated channel %v\n", channel.ChanId)
+	}
+
+	return nil
+}
+
+// parseChanPoint parses a channel point in txid:index notation.
+func parseChanPoint(s string) (*lnrpc.ChannelPoint, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid channel point: %v", s)
+	}
+
+	index, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel point: %v", s)
+	}
+
+	return &lnrpc.ChannelPoint{
+		FundingTxid: &lnrpc.ChannelPoint_FundingTxidStr{
+			FundingTxidStr: parts[0],
+		},
+		OutputIndex: uint32(index),
+	}, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jroimartin/gocui"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+const routeViewName = "route"
+
+// inspectIdx is the index in msgLines of the sent message that is shown in
+// the route popup. A negative value means that the popup is closed.
+var inspectIdx = -1
+
+// setRouteKeybindings installs the keys to open, navigate and close the
+// route popup.
+func setRouteKeybindings(g *gocui.Gui) error {
+	err := g.SetKeybinding("send", gocui.KeyCtrlR, gocui.ModNone, toggleRoute)
+	if err != nil {
+		return err
+	}
+
+	err = g.SetKeybinding(
+		routeViewName, gocui.KeyCtrlR, gocui.ModNone, toggleRoute,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = g.SetKeybinding(
+		routeViewName, gocui.KeyEsc, gocui.ModNone, toggleRoute,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = g.SetKeybinding(
+		routeViewName, gocui.KeyArrowUp, gocui.ModNone,
+		func(g *gocui.Gui, v *gocui.View) error {
+			return selectSentMsg(g, -1)
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return g.SetKeybinding(
+		routeViewName, gocui.KeyArrowDown, gocui.ModNone,
+		func(g *gocui.Gui, v *gocui.View) error {
+			return selectSentMsg(g, 1)
+		},
+	)
+}
+
+// toggleRoute opens the route popup for the last sent message, or closes it
+// when it is already open.
+func toggleRoute(g *gocui.Gui, v *gocui.View) error {
+	if inspectIdx >= 0 {
+		inspectIdx = -1
+		return nil
+	}
+
+	for i := len(msgLines) - 1; i >= 0; i-- {
+		if msgLines[i].recipient != nil {
+			inspectIdx = i
+			break
+		}
+	}
+
+	return nil
+}
+
+// selectSentMsg moves the route popup to the previous or next sent message.
+func selectSentMsg(g *gocui.Gui, step int) error {
+	for i := inspectIdx + step; i >= 0 && i < len(msgLines); i += step {
+		if msgLines[i].recipient != nil {
+			inspectIdx = i
+			break
+		}
+	}
+
+	return updateView(g)
+}
+
+// layoutRouteView creates or removes the route popup depending on whether a
+// message is being inspected.
+func layoutRouteView(g *gocui.Gui) error {
+	if inspectIdx < 0 {
+		if err := g.DeleteView(routeViewName); err != nil &&
+			err != gocui.ErrUnknownView {
+
+			return err
+		}
+
+		// Deleting a view doesn't move the focus, so give it back to the
+		// send box explicitly.
+		if v := g.CurrentView(); v == nil || v.Name() == routeViewName {
+			_, err := g.SetCurrentView("send")
+			return err
+		}
+
+		return nil
+	}
+
+	maxX, maxY := g.Size()
+	v, err := g.SetView(
+		routeViewName, maxX/8, maxY/8, maxX*7/8, maxY*7/8,
+	)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = " Route (up/down to select, esc to close) "
+
+		if _, err := g.SetCurrentView(routeViewName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateRouteView renders the delivery details of the inspected message.
+func updateRouteView(g *gocui.Gui) {
+	v, err := g.View(routeViewName)
+	if err != nil || inspectIdx < 0 || inspectIdx >= len(msgLines) {
+		return
+	}
+	v.Clear()
+
+	line := msgLines[inspectIdx]
+
+	fmt.Fprintf(v, " Message:   %v\n", line.text)
+	fmt.Fprintf(v, " To:        %v\n", aliasOrKey(*line.recipient))
+	fmt.Fprintf(v, " State:     %v\n", line.state)
+	fmt.Fprintf(v, " Attempts:  %v\n", line.attempts)
+	if line.state != statePending {
+		fmt.Fprintf(v, " Time:      %v\n",
+			line.deliveryTime.Round(time.Millisecond))
+	}
+
+	r := line.route
+	if r == nil {
+		return
+	}
+
+	fmt.Fprintf(v, " Total fee: %v msat\n", r.TotalFeesMsat)
+	fmt.Fprintf(v, " Timelock:  %v\n\n", r.TotalTimeLock)
+
+	fmt.Fprintf(v, " %-3v %-20v %-16v %10v %8v %6v\n",
+		"#", "node", "channel", "fee msat", "expiry", "delta")
+
+	prevExpiry := r.TotalTimeLock
+	for i, hop := range r.Hops {
+		var alias string
+		key, err := route.NewVertexFromStr(hop.PubKey)
+		if err == nil {
+			alias = aliasOrKey(key)
+		}
+		if len(alias) > 20 {
+			alias = alias[:20]
+		}
+
+		chanID := lnwire.NewShortChanIDFromInt(hop.ChanId)
+
+		fmt.Fprintf(v, " %-3v %-20v %-16v %10v %8v %6v\n",
+			i+1, alias, chanID, hop.FeeMsat, hop.Expiry,
+			prevExpiry-hop.Expiry)
+
+		prevExpiry = hop.Expiry
+	}
+}
+
+// aliasOrKey returns the alias of a node, falling back to its abbreviated
+// public key for nodes that aren't in the graph.
+func aliasOrKey(key route.Vertex) string {
+	if alias, ok := keyToAlias[key]; ok && alias != "" {
+		return alias
+	}
+
+	return key.String()[:16]
+}
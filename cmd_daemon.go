@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+	"github.com/urfave/cli"
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultDaemonListen = "localhost:8091"
+
+	defaultDaemonRPCListen = "localhost:8092"
+
+	daemonTokenFilename = "daemon.token"
+
+	// shutdownTimeout limits how long open http requests are waited for
+	// on shutdown.
+	shutdownTimeout = 5 * time.Second
+)
+
+var daemonCommand = cli.Command{
+	Name:     "daemon",
+	Category: "Chat",
+	Usage:    "Run whatsat in the background and expose a local API.",
+	Description: `
+	Run the chat engine without the terminal interface and expose it through
+	an HTTP/JSON API and a gRPC API, so that other programs can send and
+	receive messages. The gRPC service is defined in
+	whatsatrpc/whatsat.proto.
+
+	The APIs listen on localhost by default. Use unix:///path/to/socket to
+	listen on a unix socket instead, or an empty address to disable an API.
+	Every request must carry the header (or gRPC metadata)
+	'Authorization: Bearer <token>'. If no token is specified, a random
+	token is generated and written to daemon.token in the data directory.
+
+	Contacts that are added through the gRPC API are stored in
+	contacts.json in the data directory.
+
+	Incoming messages can be posted to webhooks as json. Each request
+	carries the header 'X-Whatsat-Signature: sha256=<hmac>', the hex encoded
+	HMAC-SHA256 of the body keyed with the webhook secret. Failed requests
+	are retried a few times with increasing delays. Messages are posted to
+	each webhook in order; they are dropped while too many messages wait
+	for a webhook.
+
+	HTTP endpoints:
+	  POST /messages        send {"peer": "<pubkey, alias or address>",
+	                        "text": "..."}
+	  GET  /messages        message history, optionally ?peer=<pubkey>
+	  GET  /conversations   one summary per peer
+	  GET  /events          server-sent events for incoming messages and
+	                        delivery updates
+	`,
+	Action: actionDecorator(daemon),
+	Flags: append([]cli.Flag{
+		cli.Uint64Flag{
+			Name:  "amt_msat",
+			Usage: "payment amount per chat message",
+			Value: 1000,
+		},
+		cli.StringFlag{
+			Name: "listen",
+			Usage: "address to serve the http api on, host:port or " +
+				"unix:///path/to/socket",
+			Value: defaultDaemonListen,
+		},
+		cli.StringFlag{
+			Name: "rpclisten",
+			Usage: "address to serve the grpc api on, host:port or " +
+				"unix:///path/to/socket",
+			Value: defaultDaemonRPCListen,
+		},
+		cli.StringFlag{
+			Name:   "token",
+			Usage:  "bearer token that api clients must present",
+			EnvVar: "WHATSAT_DAEMON_TOKEN",
+		},
+		cli.StringSliceFlag{
+			Name: "webhook",
+			Usage: "url to post incoming messages to; can be " +
+				"specified multiple times",
+		},
+		cli.StringFlag{
+			Name:   "webhook_secret",
+			Usage:  "key to sign the webhook requests with",
+			EnvVar: "WHATSAT_WEBHOOK_SECRET",
+		},
+		cli.StringSliceFlag{
+			Name: "webhook_sender",
+			Usage: "only post messages from this pubkey, alias or " +
+				"contact to the webhooks; can be specified " +
+				"multiple times",
+		},
+	}, paymentPolicyFlags...),
+}
+
+func daemon(ctx *cli.Context) error {
+	conn := getClientConn(ctx, false)
+	defer conn.Close()
+
+	var err error
+	engine, err = newChatEngine(conn, int64(ctx.Uint64("amt_msat")))
+	if err != nil {
+		return err
+	}
+
+	if err := initPolicies(ctx); err != nil {
+		return err
+	}
+
+	if err := initHooks(ctx); err != nil {
+		return err
+	}
+
+	token, err := getDaemonToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	contacts, err := loadContacts(
+		filepath.Join(getDataDir(ctx), contactsFilename),
+	)
+	if err != nil {
+		return err
+	}
+
+	listenAddr := ctx.String("listen")
+	rpcListenAddr := ctx.String("rpclisten")
+	if listenAddr == "" && rpcListenAddr == "" {
+		return fmt.Errorf("both apis are disabled")
+	}
+
+	store := newMessageStore(engine, contacts)
+
+	receiveCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	webhooks, err := getWebhookDispatcher(ctx, contacts)
+	if err != nil {
+		return err
+	}
+	if webhooks != nil {
+		webhooks.start(store, receiveCtx.Done())
+	}
+
+	errChan := make(chan error, 3)
+	go func() {
+		errChan <- engine.receive(
+			receiveCtx, store.addReceived, store.sendReply,
+		)
+	}()
+
+	var restServer *http.Server
+	if listenAddr != "" {
+		listener, err := listenDaemon(listenAddr)
+		if err != nil {
+			return err
+		}
+
+		handler := newRestServer(store, token)
+		restServer = &http.Server{
+			Handler: handler,
+		}
+		restServer.RegisterOnShutdown(handler.stop)
+		go func() {
+			errChan <- restServer.Serve(listener)
+		}()
+
+		fmt.Printf("Serving http api on %v\n", listenAddr)
+	}
+
+	var grpcServer *grpc.Server
+	if rpcListenAddr != "" {
+		listener, err := listenDaemon(rpcListenAddr)
+		if err != nil {
+			return err
+		}
+
+		grpcServer = newGrpcServer(store, token)
+		go func() {
+			errChan <- grpcServer.Serve(listener)
+		}()
+
+		fmt.Printf("Serving grpc api on %v\n", rpcListenAddr)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-errChan:
+	case <-sigChan:
+	}
+
+	if grpcServer != nil {
+		grpcServer.Stop()
+	}
+	if restServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(
+			context.Background(), shutdownTimeout,
+		)
+		defer cancel()
+
+		shutdownErr := restServer.Shutdown(shutdownCtx)
+		if err == nil {
+			err = shutdownErr
+		}
+	}
+
+	return err
+}
+
+// getWebhookDispatcher sets up the webhooks from the command line flags. Nil
+// is returned if there are none.
+func getWebhookDispatcher(ctx *cli.Context,
+	contacts *contactBook) (*webhookDispatcher, error) {
+
+	urls := ctx.StringSlice("webhook")
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, fmt.Errorf("invalid webhook url: %v", u)
+		}
+	}
+
+	secret := ctx.String("webhook_secret")
+	if secret == "" {
+		return nil, fmt.Errorf("webhooks require a webhook_secret")
+	}
+
+	var senders []route.Vertex
+	for _, s := range ctx.StringSlice("webhook_sender") {
+		sender, err := contacts.resolve(s)
+		if err != nil {
+			return nil, err
+		}
+		senders = append(senders, sender)
+	}
+
+	return newWebhookDispatcher(urls, secret, senders), nil
+}
+
+// listenDaemon opens the listener for the api. Addresses with a unix://
+// prefix are unix socket paths, all others are tcp host:port pairs.
+func listenDaemon(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, "unix://") {
+		return net.Listen("tcp", addr)
+	}
+
+	path := cleanAndExpandPath(strings.TrimPrefix(addr, "unix://"))
+
+	// Remove a socket that was left behind by a previous run. Any other
+	// file at the path is left alone.
+	info, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+
+	case err != nil:
+		return nil, err
+
+	case info.Mode()&os.ModeSocket == 0:
+		return nil, fmt.Errorf("%v exists and is not a socket", path)
+
+	default:
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// getDaemonToken returns the api token from the command line. If none is
+// specified, the token is read from the data directory or generated when it
+// doesn't exist yet.
+func getDaemonToken(ctx *cli.Context) (string, error) {
+	if token := ctx.String("token"); token != "" {
+		return token, nil
+	}
+
+	path := filepath.Join(getDataDir(ctx), daemonTokenFilename)
+
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		token := strings.TrimSpace(string(b))
+		if token == "" {
+			return "", fmt.Errorf("empty token in %v", path)
+		}
+		return token, nil
+
+	case !os.IsNotExist(err):
+		return "", err
+	}
+
+	var tokenBytes [32]byte
+	if _, err := rand.Read(tokenBytes[:]); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(tokenBytes[:])
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Generated api token in %v\n", path)
+
+	return token, nil
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lightningnetwork/lnd/keychain"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/signrpc"
+	"github.com/lightningnetwork/lnd/routing/route"
+	"github.com/urfave/cli"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// doctorTimeout limits how long a check waits for lnd.
+	doctorTimeout = 30 * time.Second
+
+	// keySendCheckInvoices is the number of latest invoices that are
+	// searched for key send payments.
+	keySendCheckInvoices = 100
+)
+
+var doctorCommand = cli.Command{
+	Name:     "doctor",
+	Category: "Setup",
+	Usage:    "Check whether lnd is set up correctly for chatting.",
+	Description: `
+	Runs a series of checks against lnd and prints a pass/fail report with
+	hints on how to fix the problems that were found: the lnd version, the
+	router and signer sub-servers, the macaroon permissions, channels,
+	liquidity and whether the node can be found by senders.`,
+	Action: actionDecorator(doctor),
+	Flags: []cli.Flag{
+		cli.Uint64Flag{
+			Name:  "amt_msat",
+			Usage: "chat payment amount to check the liquidity for",
+			Value: 1000,
+		},
+	},
+}
+
+type checkResult uint8
+
+const (
+	checkPass checkResult = iota
+
+	checkWarn
+
+	checkFail
+)
+
+func (r checkResult) String() string {
+	switch r {
+	case checkPass:
+		return "\x1b[32mPASS\x1b[0m"
+	case checkWarn:
+		return "\x1b[33mWARN\x1b[0m"
+	default:
+		return "\x1b[31mFAIL\x1b[0m"
+	}
+}
+
+// doctorReport collects the outcome of the checks.
+type doctorReport struct {
+	failed int
+}
+
+// report prints the outcome of a single check. The hint is only printed for
+// checks that didn't pass.
+func (d *doctorReport) report(result checkResult, name, detail,
+	hint string) {
+
+	fmt.Printf("[%v] %v: %v\n", result, name, detail)
+	if result != checkPass && hint != "" {
+		fmt.Printf("       %v\n", hint)
+	}
+
+	if result == checkFail {
+		d.failed++
+	}
+}
+
+// isPermissionDenied returns whether lnd rejected a call because the macaroon
+// lacks the required permission.
+func isPermissionDenied(err error) bool {
+	return status.Code(err) == codes.PermissionDenied ||
+		strings.Contains(err.Error(), "permission denied")
+}
+
+func doctor(ctx *cli.Context) error {
+	amtMsat := int64(ctx.Uint64("amt_msat"))
+	ctxb := context.Background()
+
+	conn := getClientConn(ctx, false)
+	defer conn.Close()
+
+	mainRpc := lnrpc.NewLightningClient(conn)
+	routerClient := routerrpc.NewRouterClient(conn)
+	signClient := signrpc.NewSignerClient(conn)
+
+	report := &doctorReport{}
+
+	info, err := mainRpc.GetInfo(ctxb, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		report.report(checkFail, "connection", err.Error(),
+			"check that lnd is running and unlocked and that "+
+				"the connection settings are correct")
+		return fmt.Errorf("unable to connect to lnd")
+	}
+	report.report(checkPass, "connection", info.Alias, "")
+
+	checkVersion(report, info.Version)
+
+	if info.SyncedToChain && info.SyncedToGraph {
+		report.report(checkPass, "sync", "synced to chain and graph", "")
+	} else {
+		report.report(checkWarn, "sync", fmt.Sprintf("synced to "+
+			"chain: %v, synced to graph: %v", info.SyncedToChain,
+			info.SyncedToGraph),
+			"wait for lnd to finish syncing, routes may not be "+
+				"found until then")
+	}
+
+	checkRouter(report, routerClient)
+	checkSigner(report, signClient, info.IdentityPubkey)
+	checkInvoices(report, mainRpc)
+
+	checkChannels(report, mainRpc, amtMsat)
+
+	if report.failed > 0 {
+		return fmt.Errorf("%v checks failed", report.failed)
+	}
+
+	return nil
+}
+
+// checkVersion checks that lnd is recent enough to support custom records and
+// key send, which were released in lnd 0.9.
+func checkVersion(report *doctorReport, version string) {
+	if len(strings.Fields(version)) == 0 {
+		report.report(checkFail, "version", "unknown",
+			"lnd didn't report its version")
+		return
+	}
+
+	fields := strings.SplitN(strings.Fields(version)[0], ".", 3)
+
+	var major, minor int
+	if len(fields) >= 2 {
+		major, _ = strconv.Atoi(fields[0])
+		minor, _ = strconv.Atoi(fields[1])
+	}
+
+	if major > 0 || minor >= 9 {
+		report.report(checkPass, "version", version, "")
+		return
+	}
+
+	report.report(checkWarn, "version", version, "lnd 0.9 or later is "+
+		"needed for custom records and key send, unless this is a "+
+		"build of the master branch")
+}
+
+// checkRouter checks that the router sub-server is available and that the
+// macaroon allows sending payments.
+func checkRouter(report *doctorReport, client routerrpc.RouterClient) {
+	const name = "router sub-server"
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	// Send an invalid payment. The macaroon and sub-server checks happen
+	// before the request is validated, so a validation error means that
+	// sending would have been possible.
+	stream, err := client.SendPayment(ctx, &routerrpc.SendPaymentRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+
+	switch {
+	case err == nil || err == io.EOF:
+		report.report(checkPass, name, "available", "")
+
+	case status.Code(err) == codes.Unimplemented:
+		report.report(checkFail, name, "not available",
+			"build lnd with the routerrpc tag: "+
+				"make tags=\"signrpc routerrpc\"")
+
+	case isPermissionDenied(err):
+		report.report(checkFail, name, "macaroon can't send payments",
+			"use a macaroon with offchain:write permission, "+
+				"for example from 'whatsat bakemacaroon'")
+
+	default:
+		report.report(checkPass, name, "available", "")
+	}
+}
+
+// checkSigner checks that the signer sub-server is available and that the
+// macaroon allows signing and verifying messages.
+func checkSigner(report *doctorReport, client signrpc.SignerClient,
+	identityPubkey string) {
+	const name = "signer sub-server"
+
+	hint := "use a macaroon with signer:generate and signer:read " +
+		"permissions, for example from 'whatsat bakemacaroon'. If " +
+		"you upgraded lnd, regenerate admin.macaroon."
+
+	msg := []byte("whatsat doctor")
+	signResp, err := client.SignMessage(
+		context.Background(), &signrpc.SignMessageReq{
+			Msg: msg,
+			KeyLoc: &signrpc.KeyLocator{
+				KeyFamily: int32(keychain.KeyFamilyNodeKey),
+			},
+		},
+	)
+	switch {
+	case err == nil:
+
+	case status.Code(err) == codes.Unimplemented:
+		report.report(checkFail, name, "not available",
+			"build lnd with the signrpc tag: "+
+				"make tags=\"signrpc routerrpc\"")
+		return
+
+	case isPermissionDenied(err):
+		report.report(checkFail, name, "macaroon can't sign", hint)
+		return
+
+	default:
+		report.report(checkFail, name, err.Error(), "")
+		return
+	}
+
+	pubKey, err := route.NewVertexFromStr(identityPubkey)
+	if err != nil {
+		report.report(checkFail, name, err.Error(), "")
+		return
+	}
+
+	verifyResp, err := client.VerifyMessage(
+		context.Background(), &signrpc.VerifyMessageReq{
+			Msg:       msg,
+			Signature: signResp.Signature,
+			Pubkey:    pubKey[:],
+		},
+	)
+	switch {
+	case err != nil && isPermissionDenied(err):
+		report.report(checkFail, name, "macaroon can't verify", hint)
+		return
+
+	case err != nil:
+		report.report(checkFail, name, err.Error(), "")
+		return
+
+	case !verifyResp.Valid:
+		report.report(checkFail, name, "signature of our own node "+
+			"doesn't verify", "")
+		return
+	}
+
+	report.report(checkPass, name, "available", "")
+}
+
+// checkInvoices checks that the macaroon allows reading invoices, which is
+// needed to receive messages. The latest invoices also show whether lnd
+// accepts key send payments, because lnd doesn't report its configuration.
+func checkInvoices(report *doctorReport, client lnrpc.LightningClient) {
+	invoices, err := client.ListInvoices(
+		context.Background(), &lnrpc.ListInvoiceRequest{
+			NumMaxInvoices: keySendCheckInvoices,
+			Reversed:       true,
+		},
+	)
+	if err != nil {
+		report.report(checkFail, "invoices", err.Error(),
+			"use a macaroon with invoices:read permission to "+
+				"receive messages")
+		return
+	}
+
+	report.report(checkPass, "invoices", "readable", "")
+
+	for _, invoice := range invoices.Invoices {
+		for _, htlc := range invoice.Htlcs {
+			if _, ok := htlc.CustomRecords[tlvKeySendRecord]; ok {
+				report.report(checkPass, "keysend",
+					"key send payments received", "")
+				return
+			}
+		}
+	}
+
+	report.report(checkWarn, "keysend", "no key send payments received "+
+		"recently", "make sure lnd runs with --accept-keysend, "+
+		"otherwise incoming messages are rejected")
+}
+
+// checkChannels checks that there are active channels with enough liquidity
+// in both directions and whether they are public.
+func checkChannels(report *doctorReport, client lnrpc.LightningClient,
+	amtMsat int64) {
+
+	channels, err := client.ListChannels(
+		context.Background(), &lnrpc.ListChannelsRequest{
+			ActiveOnly: true,
+		},
+	)
+	if err != nil {
+		report.report(checkFail, "channels", err.Error(),
+			"use a macaroon with offchain:read permission")
+		return
+	}
+
+	if len(channels.Channels) == 0 {
+		report.report(checkFail, "channels", "no active channels",
+			"open a channel to a well-connected node, see "+
+				"'whatsat chatpeers'")
+		return
+	}
+
+	var outbound, inbound int64
+	var public int
+	for _, channel := range channels.Channels {
+		outbound += channel.LocalBalance - channel.LocalChanReserveSat
+		inbound += channel.RemoteBalance - channel.RemoteChanReserveSat
+		if !channel.Private {
+			public++
+		}
+	}
+	report.report(checkPass, "channels", fmt.Sprintf("%v active",
+		len(channels.Channels)), "")
+
+	// Each message pays up to ten times the chat amount.
+	maxPayAmtSat := amtMsat * 10 / 1000
+
+	if outbound > maxPayAmtSat {
+		report.report(checkPass, "outbound liquidity",
+			fmt.Sprintf("%v sat", outbound), "")
+	} else {
+		report.report(checkFail, "outbound liquidity",
+			fmt.Sprintf("%v sat", outbound),
+			"fund a channel to be able to send messages")
+	}
+
+	if inbound > maxPayAmtSat {
+		report.report(checkPass, "inbound liquidity",
+			fmt.Sprintf("%v sat", inbound), "")
+	} else {
+		report.report(checkFail, "inbound liquidity",
+			fmt.Sprintf("%v sat", inbound),
+			"get a channel opened to you or make payments to "+
+				"be able to receive messages")
+	}
+
+	if public > 0 {
+		report.report(checkPass, "public channels",
+			fmt.Sprintf("%v of %v", public, len(channels.Channels)),
+			"")
+	} else {
+		report.report(checkWarn, "public channels", "none",
+			"senders can't find routes to you, share the "+
+				"output of 'whatsat address' instead of your "+
+				"pubkey")
+	}
+}
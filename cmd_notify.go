@@ -0,0 +1,447 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/routing/route"
+	"github.com/urfave/cli"
+)
+
+var notifyCommand = cli.Command{
+	Name:      "notify",
+	Category:  "Chat",
+	ArgsUsage: "operator [operator ...]",
+	Usage:     "Send node events to operators as chat messages.",
+	Description: `
+	Watch the node and send a short chat message to the operators, given as
+	pubkeys, aliases or chat addresses, when something happens:
+
+	  - channels are opened, closed, become inactive or active again
+	  - peers change the policy of their side of our channels
+	  - payments were forwarded since the last poll
+	  - the local balance of a channel drops below --low_balance_sat
+
+	The same notification isn't repeated within --dedup_interval. During
+	--quiet_hours, for example 22:00-07:00 in local time, notifications are
+	held back and sent as a single message when the quiet hours end.`,
+	Action: actionDecorator(notify),
+	Flags: append([]cli.Flag{
+		cli.Uint64Flag{
+			Name:  "amt_msat",
+			Usage: "payment amount per chat message",
+			Value: 1000,
+		},
+		cli.Int64Flag{
+			Name: "low_balance_sat",
+			Usage: "notify when the local balance of an active " +
+				"channel is below this amount (0 disables)",
+		},
+		cli.DurationFlag{
+			Name: "poll_interval",
+			Usage: "interval for checking forwards and channel " +
+				"balances",
+			Value: time.Minute,
+		},
+		cli.DurationFlag{
+			Name:  "dedup_interval",
+			Usage: "do not repeat a notification within this time",
+			Value: time.Hour,
+		},
+		cli.StringFlag{
+			Name: "quiet_hours",
+			Usage: "hold back notifications during this time of " +
+				"day, e.g. 22:00-07:00",
+		},
+		cli.BoolFlag{
+			Name:  "no_graph",
+			Usage: "do not notify about channel policy changes",
+		},
+		cli.BoolFlag{
+			Name:  "no_forwards",
+			Usage: "do not notify about forwarded payments",
+		},
+	}, paymentPolicyFlags...),
+}
+
+func notify(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("no operators specified")
+	}
+
+	var quiet *quietHours
+	if ctx.IsSet("quiet_hours") {
+		var err error
+		quiet, err = parseQuietHours(ctx.String("quiet_hours"))
+		if err != nil {
+			return err
+		}
+	}
+
+	conn := getClientConn(ctx, false)
+	defer conn.Close()
+
+	var err error
+	engine, err = newChatEngine(conn, int64(ctx.Uint64("amt_msat")))
+	if err != nil {
+		return err
+	}
+
+	if err := initPolicies(ctx); err != nil {
+		return err
+	}
+
+	if err := initHooks(ctx); err != nil {
+		return err
+	}
+
+	var operators []route.Vertex
+	for _, arg := range ctx.Args() {
+		operator, err := resolveDest(arg)
+		if err != nil {
+			return err
+		}
+		operators = append(operators, operator)
+	}
+
+	n := newNotifier(
+		engine, operators, ctx.Duration("dedup_interval"), quiet,
+	)
+	client := engine.mainRpc
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errChan := make(chan error, 4)
+	go func() {
+		errChan <- watchChannelEvents(watchCtx, client, n)
+	}()
+	if !ctx.Bool("no_graph") {
+		go func() {
+			errChan <- watchChannelPolicies(watchCtx, client, n)
+		}()
+	}
+
+	pollInterval := ctx.Duration("poll_interval")
+	go func() {
+		errChan <- pollNode(
+			watchCtx, client, n, pollInterval,
+			ctx.Int64("low_balance_sat"),
+			!ctx.Bool("no_forwards"),
+		)
+	}()
+
+	fmt.Printf("Notifying %v operator(s), press ctrl-c to stop\n",
+		len(operators))
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-errChan:
+		return err
+	case <-sigChan:
+		return nil
+	}
+}
+
+// watchChannelEvents notifies about channels that are opened, closed or
+// change their active state.
+func watchChannelEvents(ctx context.Context, client lnrpc.LightningClient,
+	n *notifier) error {
+
+	stream, err := client.SubscribeChannelEvents(
+		ctx, &lnrpc.ChannelEventSubscription{},
+	)
+	if err != nil {
+		return err
+	}
+
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch update.Type {
+		case lnrpc.ChannelEventUpdate_OPEN_CHANNEL:
+			c := update.GetOpenChannel()
+			n.notify("", fmt.Sprintf(
+				"Channel %v with %v opened, capacity %v sat",
+				lnwire.NewShortChanIDFromInt(c.ChanId),
+				peerName(c.RemotePubkey), c.Capacity,
+			))
+
+		case lnrpc.ChannelEventUpdate_CLOSED_CHANNEL:
+			c := update.GetClosedChannel()
+			n.notify("", fmt.Sprintf(
+				"Channel %v with %v closed (%v)",
+				lnwire.NewShortChanIDFromInt(c.ChanId),
+				peerName(c.RemotePubkey), c.CloseType,
+			))
+
+		case lnrpc.ChannelEventUpdate_ACTIVE_CHANNEL:
+			chanPoint, err := formatChanPoint(
+				update.GetActiveChannel(),
+			)
+			if err != nil {
+				return err
+			}
+
+			n.notify("active:"+chanPoint, fmt.Sprintf(
+				"Channel with %v is active",
+				channelPeerName(ctx, client, chanPoint),
+			))
+
+		case lnrpc.ChannelEventUpdate_INACTIVE_CHANNEL:
+			chanPoint, err := formatChanPoint(
+				update.GetInactiveChannel(),
+			)
+			if err != nil {
+				return err
+			}
+
+			n.notify("inactive:"+chanPoint, fmt.Sprintf(
+				"Channel with %v is inactive",
+				channelPeerName(ctx, client, chanPoint),
+			))
+		}
+	}
+}
+
+// channelPolicy is the part of a routing policy that is reported to the
+// operators.
+type channelPolicy struct {
+	baseFee  int64
+	feeRate  int64
+	disabled bool
+}
+
+// policyKey identifies one side of a channel.
+type policyKey struct {
+	chanID uint64
+	node   string
+}
+
+// watchChannelPolicies notifies about peers that change the policy of their
+// side of our channels. Only actual changes are reported: nodes rebroadcast
+// unchanged policies periodically.
+func watchChannelPolicies(ctx context.Context, client lnrpc.LightningClient,
+	n *notifier) error {
+
+	stream, err := client.SubscribeChannelGraph(
+		ctx, &lnrpc.GraphTopologySubscription{},
+	)
+	if err != nil {
+		return err
+	}
+
+	selfStr := self.String()
+
+	// Start from the policies that are known now, so that the first
+	// update after startup isn't mistaken for a change.
+	graph, err := client.DescribeGraph(ctx, &lnrpc.ChannelGraphRequest{})
+	if err != nil {
+		return err
+	}
+
+	known := make(map[policyKey]channelPolicy)
+	record := func(chanID uint64, node string, p *lnrpc.RoutingPolicy) {
+		if p == nil {
+			return
+		}
+		known[policyKey{chanID, node}] = channelPolicy{
+			baseFee:  p.FeeBaseMsat,
+			feeRate:  p.FeeRateMilliMsat,
+			disabled: p.Disabled,
+		}
+	}
+	for _, e := range graph.Edges {
+		switch selfStr {
+		case e.Node1Pub:
+			record(e.ChannelId, e.Node2Pub, e.Node2Policy)
+		case e.Node2Pub:
+			record(e.ChannelId, e.Node1Pub, e.Node1Policy)
+		}
+	}
+
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		for _, u := range update.ChannelUpdates {
+			if u.ConnectingNode != selfStr ||
+				u.AdvertisingNode == selfStr ||
+				u.RoutingPolicy == nil {
+
+				continue
+			}
+
+			key := policyKey{u.ChanId, u.AdvertisingNode}
+			last, ok := known[key]
+			record(u.ChanId, u.AdvertisingNode, u.RoutingPolicy)
+			policy := known[key]
+
+			// The first policy of a new channel is covered by
+			// the channel open notification.
+			if !ok || policy == last {
+				continue
+			}
+
+			state := "enabled"
+			if policy.disabled {
+				state = "disabled"
+			}
+
+			n.notify("", fmt.Sprintf(
+				"%v set channel %v to base fee %v msat, fee "+
+					"rate %v ppm, %v",
+				peerName(u.AdvertisingNode),
+				lnwire.NewShortChanIDFromInt(u.ChanId),
+				policy.baseFee, policy.feeRate, state,
+			))
+		}
+	}
+}
+
+// pollNode periodically notifies about forwarded payments and channels with a
+// low local balance.
+func pollNode(ctx context.Context, client lnrpc.LightningClient, n *notifier,
+	interval time.Duration, lowBalance int64, forwards bool) error {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Forwards are read from the start time on. Every query continues at
+	// the offset where the previous one ended, so that no forward is
+	// missed or counted twice.
+	start := uint64(time.Now().Unix())
+	var offset uint32
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+
+		n.flush()
+
+		if forwards {
+			var err error
+			offset, err = checkForwards(
+				ctx, client, n, start, offset,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		if lowBalance > 0 {
+			err := checkBalances(ctx, client, n, lowBalance)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkForwards summarizes the payments that were forwarded since the start
+// time, beyond the offset of the forwards that were already seen, in a single
+// notification. It returns the offset to continue from.
+func checkForwards(ctx context.Context, client lnrpc.LightningClient,
+	n *notifier, start uint64, offset uint32) (uint32, error) {
+
+	// Without an end time, lnd returns the forwards up to the current
+	// time.
+	resp, err := client.ForwardingHistory(
+		ctx, &lnrpc.ForwardingHistoryRequest{
+			StartTime:    start,
+			IndexOffset:  offset,
+			NumMaxEvents: 50000,
+		},
+	)
+	if err != nil {
+		return offset, err
+	}
+
+	if len(resp.ForwardingEvents) == 0 {
+		return offset, nil
+	}
+
+	var amt, fee uint64
+	for _, e := range resp.ForwardingEvents {
+		amt += e.AmtOutMsat
+		fee += e.FeeMsat
+	}
+
+	n.notify("", fmt.Sprintf(
+		"Forwarded %v payment(s) of %v sat, earned %v msat",
+		len(resp.ForwardingEvents), amt/1000, fee,
+	))
+
+	return resp.LastOffsetIndex, nil
+}
+
+// checkBalances notifies about active channels with a local balance below the
+// threshold.
+func checkBalances(ctx context.Context, client lnrpc.LightningClient,
+	n *notifier, lowBalance int64) error {
+
+	resp, err := client.ListChannels(
+		ctx, &lnrpc.ListChannelsRequest{ActiveOnly: true},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range resp.Channels {
+		if c.LocalBalance >= lowBalance {
+			continue
+		}
+
+		n.notify(fmt.Sprintf("balance:%v", c.ChanId), fmt.Sprintf(
+			"Low balance on channel %v with %v: %v sat",
+			lnwire.NewShortChanIDFromInt(c.ChanId),
+			peerName(c.RemotePubkey), c.LocalBalance,
+		))
+	}
+
+	return nil
+}
+
+// peerName returns the alias of a node given as a hex pubkey.
+func peerName(pubKey string) string {
+	key, err := route.NewVertexFromStr(pubKey)
+	if err != nil {
+		return pubKey
+	}
+
+	return aliasOrKey(key)
+}
+
+// channelPeerName looks up the peer of the channel with the given channel
+// point.
+func channelPeerName(ctx context.Context, client lnrpc.LightningClient,
+	chanPoint string) string {
+
+	resp, err := client.ListChannels(ctx, &lnrpc.ListChannelsRequest{})
+	if err != nil {
+		return chanPoint
+	}
+
+	for _, c := range resp.Channels {
+		if c.ChannelPoint == chanPoint {
+			return peerName(c.RemotePubkey)
+		}
+	}
+
+	return chanPoint
+}
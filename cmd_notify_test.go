@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
+)
+
+// forwardingClient serves a forwarding history like lnd does. Calls to other
+// methods panic through the nil embedded interface.
+type forwardingClient struct {
+	lnrpc.LightningClient
+
+	events   []*lnrpc.ForwardingEvent
+	requests []*lnrpc.ForwardingHistoryRequest
+}
+
+func (c *forwardingClient) ForwardingHistory(_ context.Context,
+	req *lnrpc.ForwardingHistoryRequest,
+	_ ...grpc.CallOption) (*lnrpc.ForwardingHistoryResponse, error) {
+
+	c.requests = append(c.requests, req)
+
+	resp := &lnrpc.ForwardingHistoryResponse{
+		LastOffsetIndex: req.IndexOffset,
+	}
+	for _, e := range c.events[req.IndexOffset:] {
+		resp.ForwardingEvents = append(resp.ForwardingEvents, e)
+		resp.LastOffsetIndex++
+	}
+
+	return resp, nil
+}
+
+func TestCheckForwards(t *testing.T) {
+	client := &forwardingClient{}
+
+	// Quiet hours for the whole day hold back all notifications, so that
+	// they can be inspected without sending them.
+	n := newNotifier(nil, nil, 0, &quietHours{start: 0, end: 24 * 60})
+
+	forward := func(amtMsat, feeMsat uint64) {
+		client.events = append(client.events, &lnrpc.ForwardingEvent{
+			AmtOutMsat: amtMsat,
+			FeeMsat:    feeMsat,
+		})
+	}
+
+	var offset uint32
+	check := func(expectedOffset uint32) {
+		t.Helper()
+
+		var err error
+		offset, err = checkForwards(
+			context.Background(), client, n, 1000, offset,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != expectedOffset {
+			t.Fatalf("expected offset %v, got %v", expectedOffset,
+				offset)
+		}
+	}
+
+	forward(10000, 1)
+	forward(20000, 2)
+	check(2)
+
+	// Nothing new, no notification.
+	check(2)
+
+	// Only the new forward is counted.
+	forward(5000, 3)
+	check(3)
+
+	expected := []string{
+		"Forwarded 2 payment(s) of 30 sat, earned 3 msat",
+		"Forwarded 1 payment(s) of 5 sat, earned 3 msat",
+	}
+	if !reflect.DeepEqual(n.held, expected) {
+		t.Fatalf("expected notifications %v, got %v", expected, n.held)
+	}
+
+	for i, req := range client.requests {
+		if req.StartTime != 1000 || req.EndTime != 0 {
+			t.Fatalf("request %v: unexpected time range %v-%v", i,
+				req.StartTime, req.EndTime)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/routing/route"
+	"github.com/urfave/cli"
+)
+
+var simulateCommand = cli.Command{
+	Name:      "simulate",
+	Category:  "Chat",
+	ArgsUsage: "target_pubkey_or_alias...",
+	Usage: "Simulate how opening a channel to a peer changes the fees " +
+		"for chatting with a set of contacts.",
+	Description: `
+	Finds the cheapest routes for the chat amount from our node to each of
+	the targets in the local copy of the channel graph. This is done once
+	for the current graph and once with an additional channel between our
+	node and the peer, to show how much the channel would save per target.
+
+	The peer charges the fees of its existing channels to forward over
+	them, so its policy on the new channel doesn't affect the routes.`,
+	Action: actionDecorator(simulate),
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "peer",
+			Usage: "pubkey or alias of the candidate peer",
+		},
+		cli.Uint64Flag{
+			Name:  "amt_msat",
+			Usage: "chat payment amount to calculate fees for",
+			Value: 1000,
+		},
+		cli.Int64Flag{
+			Name:  "capacity",
+			Usage: "capacity in sat of the hypothetical channel",
+			Value: 1000000,
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the results as json",
+		},
+	},
+}
+
+// simulatedTarget is the output format of the simulation for a single target.
+type simulatedTarget struct {
+	Target      string `json:"target"`
+	Alias       string `json:"alias"`
+	Reachable   bool   `json:"reachable"`
+	FeeMsat     int64  `json:"fee_msat"`
+	Hops        int    `json:"hops"`
+	NewFeeMsat  int64  `json:"new_fee_msat"`
+	NewHops     int    `json:"new_hops"`
+	Improvement int64  `json:"improvement_msat"`
+}
+
+func simulate(ctx *cli.Context) error {
+	amtMsat := int64(ctx.Uint64("amt_msat"))
+
+	if !ctx.IsSet("peer") {
+		return fmt.Errorf("peer argument missing")
+	}
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("no targets specified")
+	}
+
+	client, cleanUp := getClient(ctx)
+	defer cleanUp()
+
+	graph, err := client.DescribeGraph(
+		context.Background(), &lnrpc.ChannelGraphRequest{},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := addAliases(graph); err != nil {
+		return err
+	}
+
+	info, err := client.GetInfo(
+		context.Background(), &lnrpc.GetInfoRequest{},
+	)
+	if err != nil {
+		return err
+	}
+	source := info.IdentityPubkey
+
+	peer, err := parseNode(ctx.String("peer"))
+	if err != nil {
+		return err
+	}
+
+	var targets []string
+	for _, targetStr := range ctx.Args() {
+		target, err := parseNode(targetStr)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, target.String())
+	}
+
+	capacity := ctx.Int64("capacity")
+	results := simulateChannel(
+		graph, source, peer.String(), capacity, amtMsat, targets,
+	)
+
+	if ctx.Bool("json") {
+		printJSON(results)
+		return nil
+	}
+
+	fmt.Printf("Simulating a channel of %v sat to %v (%v)\n\n", capacity,
+		peer, keyToAlias[peer])
+
+	for _, r := range results {
+		switch {
+		case !r.Reachable:
+			fmt.Printf("%v (%v): unreachable\n", r.Target, r.Alias)
+
+		case r.Hops == 0:
+			fmt.Printf("%v (%v): unreachable now, %v msat "+
+				"(%v hops) with channel\n", r.Target, r.Alias,
+				r.NewFeeMsat, r.NewHops)
+
+		default:
+			fmt.Printf("%v (%v): %v msat (%v hops) now, %v msat "+
+				"(%v hops) with channel, saves %v msat\n",
+				r.Target, r.Alias, r.FeeMsat, r.Hops,
+				r.NewFeeMsat, r.NewHops, r.Improvement)
+		}
+	}
+
+	return nil
+}
+
+// simulateChannel finds the cheapest routes from the source to the targets,
+// once in the graph and once with an additional channel between the source
+// and the peer.
+func simulateChannel(graph *lnrpc.ChannelGraph, source, peer string,
+	capacity, amtMsat int64, targets []string) []simulatedTarget {
+
+	// The graph with the new channel is built separately, so that both
+	// graphs can be searched independently. Our side of the channel is
+	// free to use for our own payments and the peer's side is only used
+	// by payments to us, so neither policy matters for the routes.
+	current := newChatGraph(graph)
+	extended := newChatGraph(graph)
+	extended.addChannel(
+		source, peer, &lnrpc.RoutingPolicy{}, &lnrpc.RoutingPolicy{},
+		capacity,
+	)
+
+	results := make([]simulatedTarget, 0, len(targets))
+	for _, target := range targets {
+		result := simulatedTarget{
+			Target: target,
+		}
+		if key, err := route.NewVertexFromStr(target); err == nil {
+			result.Alias = keyToAlias[key]
+		}
+
+		before := current.cheapestRoute(source, target, amtMsat)
+		after := extended.cheapestRoute(source, target, amtMsat)
+
+		if after != nil {
+			result.Reachable = true
+			result.NewFeeMsat = after.fee
+			result.NewHops = after.hops
+		}
+		if before != nil {
+			result.FeeMsat = before.fee
+			result.Hops = before.hops
+			result.Improvement = before.fee - after.fee
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
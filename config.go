@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+const defaultConfigFilename = "whatsat.conf"
+
+// config holds the settings of the whatsat configuration file. Settings
+// before the first section apply to all profiles. Each [section] is a named
+// profile with settings that override those. Keys are the names of the
+// global command line flags.
+//
+//	network=testnet
+//
+//	[regtest]
+//	network=regtest
+//	rpcserver=localhost:10010
+//	lnddir=~/.lnd-regtest
+type config struct {
+	defaults map[string]string
+	profiles map[string]map[string]string
+}
+
+// loadConfig parses the configuration file at the given path.
+func loadConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &config{
+		defaults: make(map[string]string),
+		profiles: make(map[string]map[string]string),
+	}
+
+	section := cfg.defaults
+	scanner := bufio.NewScanner(f)
+	for lineNr := 1; scanner.Scan(); lineNr++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("%v:%v: invalid section",
+					path, lineNr)
+			}
+
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := cfg.profiles[name]; !ok {
+				cfg.profiles[name] = make(map[string]string)
+			}
+			section = cfg.profiles[name]
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%v:%v: expected key=value",
+				path, lineNr)
+		}
+		section[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyConfig sets the global flags that weren't passed on the command line
+// from the configuration file in the data directory, using the profile that
+// was selected with --profile.
+func applyConfig(ctx *cli.Context) error {
+	path := filepath.Join(getDataDir(ctx), defaultConfigFilename)
+	profile := ctx.GlobalString("profile")
+
+	cfg, err := loadConfig(path)
+	switch {
+	// Without a configuration file, all settings come from the command
+	// line. A profile can't be selected then.
+	case os.IsNotExist(err) && profile == "":
+		return nil
+
+	case err != nil:
+		return err
+	}
+
+	settings := make(map[string]string)
+	for key, value := range cfg.defaults {
+		settings[key] = value
+	}
+
+	if profile != "" {
+		profileSettings, ok := cfg.profiles[profile]
+		if !ok {
+			return fmt.Errorf("profile %v not found in %v",
+				profile, path)
+		}
+
+		for key, value := range profileSettings {
+			settings[key] = value
+		}
+	}
+
+	// Determine the flags that are set on the command line before
+	// applying any settings, because setting a flag marks it as set.
+	cmdLine := make(map[string]bool)
+	for _, name := range ctx.GlobalFlagNames() {
+		cmdLine[name] = ctx.GlobalIsSet(name)
+	}
+
+	for key, value := range settings {
+		set, ok := cmdLine[key]
+		switch {
+		case !ok || key == "datadir" || key == "profile":
+			return fmt.Errorf("%v: unknown setting %v", path, key)
+
+		case set:
+			continue
+		}
+
+		if err := ctx.GlobalSet(key, value); err != nil {
+			return fmt.Errorf("%v: invalid value for %v: %v",
+				path, key, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+// TestApplyConfigIsSet checks that flags set from the configuration file are
+// reported as set in the commands, which the lndconnect precedence relies on.
+func TestApplyConfigIsSet(t *testing.T) {
+	dir, cleanUp := tempDir(t)
+	defer cleanUp()
+
+	err := ioutil.WriteFile(
+		filepath.Join(dir, defaultConfigFilename),
+		[]byte("rpcserver=node-a:10009\nnetwork=testnet\n\n"+
+			"[b]\nrpcserver=node-b:10009\n"),
+		0600,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args      []string
+		rpcServer string
+		network   string
+		lndDirSet bool
+	}{
+		{nil, "node-a:10009", "testnet", false},
+		{[]string{"--profile", "b"}, "node-b:10009", "testnet", false},
+		{
+			[]string{"--rpcserver", "node-c:10009", "--lnddir", "x"},
+			"node-c:10009", "testnet", true,
+		},
+	}
+
+	for _, test := range tests {
+		var rpcServer, network string
+		var rpcServerSet, lndDirSet bool
+
+		app := cli.NewApp()
+		app.Flags = []cli.Flag{
+			cli.StringFlag{Name: "datadir"},
+			cli.StringFlag{Name: "profile"},
+			cli.StringFlag{Name: "rpcserver", Value: "localhost:10009"},
+			cli.StringFlag{Name: "lnddir"},
+			cli.StringFlag{Name: "network", Value: "mainnet"},
+		}
+		app.Before = applyConfig
+		app.Commands = []cli.Command{{
+			Name: "cmd",
+			Action: func(ctx *cli.Context) error {
+				rpcServer = ctx.GlobalString("rpcserver")
+				network = ctx.GlobalString("network")
+				rpcServerSet = ctx.GlobalIsSet("rpcserver")
+				lndDirSet = ctx.GlobalIsSet("lnddir")
+				return nil
+			},
+		}}
+
+		args := append([]string{"whatsat", "--datadir", dir}, test.args...)
+		if err := app.Run(append(args, "cmd")); err != nil {
+			t.Fatal(err)
+		}
+
+		if rpcServer != test.rpcServer || network != test.network ||
+			!rpcServerSet || lndDirSet != test.lndDirSet {
+
+			t.Fatalf("%v: unexpected settings %v (set: %v), %v, "+
+				"lnddir set: %v", test.args, rpcServer,
+				rpcServerSet, network, lndDirSet)
+		}
+	}
+}
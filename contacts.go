@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+const contactsFilename = "contacts.json"
+
+// contact is a name that the user gave to a peer.
+type contact struct {
+	Name   string `json:"name"`
+	PubKey string `json:"pub_key"`
+
+	// Address is the chat address that the contact was added with. It is
+	// kept to restore the route hints.
+	Address string `json:"address,omitempty"`
+}
+
+// contactBook holds the contacts of the daemon. Contacts take precedence over
+// graph aliases when resolving a destination. They are stored as json in the
+// data directory.
+type contactBook struct {
+	path string
+
+	mtx      sync.RWMutex
+	contacts map[string]*contact
+}
+
+// loadContacts reads the contact book from the file. A missing file results in
+// an empty contact book.
+func loadContacts(path string) (*contactBook, error) {
+	c := &contactBook{
+		path:     path,
+		contacts: make(map[string]*contact),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var contacts []*contact
+	if err := json.Unmarshal(b, &contacts); err != nil {
+		return nil, fmt.Errorf("cannot parse %v: %v", path, err)
+	}
+
+	for _, contact := range contacts {
+		// Re-register the route hints of chat addresses.
+		if contact.Address != "" {
+			if _, err := resolveDest(contact.Address); err != nil {
+				return nil, err
+			}
+		}
+
+		c.contacts[contact.Name] = contact
+	}
+
+	return c, nil
+}
+
+// save writes the contact book to its file. The caller must hold the mutex.
+func (c *contactBook) save() error {
+	b, err := json.MarshalIndent(c.sorted(), "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.path, b, 0600)
+}
+
+// sorted returns the contacts sorted by name. The caller must hold the mutex.
+func (c *contactBook) sorted() []*contact {
+	list := make([]*contact, 0, len(c.contacts))
+	for _, contact := range c.contacts {
+		contactCopy := *contact
+		list = append(list, &contactCopy)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// add stores a contact for the peer, which can be a pubkey, alias or chat
+// address. An existing contact with the same name is replaced.
+func (c *contactBook) add(name, peer string) (*contact, error) {
+	if name == "" {
+		return nil, fmt.Errorf("empty contact name")
+	}
+
+	key, err := resolveDest(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	contact := &contact{
+		Name:   name,
+		PubKey: key.String(),
+	}
+	if _, err := parseChatAddress(peer); err == nil {
+		contact.Address = peer
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.contacts[name] = contact
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+
+	contactCopy := *contact
+	return &contactCopy, nil
+}
+
+// remove deletes a contact.
+func (c *contactBook) remove(name string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.contacts[name]; !ok {
+		return fmt.Errorf("unknown contact: %v", name)
+	}
+	delete(c.contacts, name)
+
+	return c.save()
+}
+
+// list returns all contacts sorted by name.
+func (c *contactBook) list() []*contact {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.sorted()
+}
+
+// resolve parses a destination that is either a contact name or anything that
+// resolveDest accepts.
+func (c *contactBook) resolve(dest string) (route.Vertex, error) {
+	c.mtx.RLock()
+	contact, ok := c.contacts[dest]
+	c.mtx.RUnlock()
+
+	if ok {
+		return route.NewVertexFromStr(contact.PubKey)
+	}
+
+	return resolveDest(dest)
+}
+
+// alias returns the contact name of the peer, or its graph alias if it isn't a
+// contact.
+func (c *contactBook) alias(key route.Vertex) string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	keyStr := key.String()
+	for _, contact := range c.contacts {
+		if contact.PubKey == keyStr {
+			return contact.Name
+		}
+	}
+
+	return keyToAlias[key]
+}
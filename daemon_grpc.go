@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"whatsat/whatsatrpc"
+)
+
+// rpcServer serves the gRPC api of the daemon. It is backed by the same message
+// store as the rest api.
+type rpcServer struct {
+	store *messageStore
+	token string
+}
+
+var _ whatsatrpc.WhatsatServer = (*rpcServer)(nil)
+
+// newGrpcServer creates a gRPC server that requires the token in the
+// authorization metadata of every call.
+func newGrpcServer(store *messageStore, token string) *grpc.Server {
+	s := &rpcServer{
+		store: store,
+		token: token,
+	}
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryAuth),
+		grpc.StreamInterceptor(s.streamAuth),
+	)
+	whatsatrpc.RegisterWhatsatServer(server, s)
+
+	return server
+}
+
+// checkToken verifies the bearer token in the metadata of the call.
+func (s *rpcServer) checkToken(ctx context.Context) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing token")
+	}
+
+	for _, auth := range md.Get("authorization") {
+		token := []byte(strings.TrimPrefix(auth, "Bearer "))
+		if subtle.ConstantTimeCompare(token, []byte(s.token)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "invalid token")
+}
+
+func (s *rpcServer) unaryAuth(ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	if err := s.checkToken(ctx); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (s *rpcServer) streamAuth(srv interface{}, stream grpc.ServerStream,
+	info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+	if err := s.checkToken(stream.Context()); err != nil {
+		return err
+	}
+
+	return handler(srv, stream)
+}
+
+// SendMessage sends a chat message to a peer.
+func (s *rpcServer) SendMessage(ctx context.Context,
+	req *whatsatrpc.SendMessageRequest) (*whatsatrpc.Message, error) {
+
+	if req.Text == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty message")
+	}
+
+	dest, err := s.store.contacts.resolve(req.Peer)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	msg, err := s.store.send(dest, req.Text)
+	if err == errVetoed {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return marshallMessage(msg), nil
+}
+
+// SubscribeMessages streams message events until the client disconnects.
+func (s *rpcServer) SubscribeMessages(req *whatsatrpc.SubscribeMessagesRequest,
+	stream whatsatrpc.Whatsat_SubscribeMessagesServer) error {
+
+	events, cancel := s.store.subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted,
+					"subscriber fell behind, events were "+
+						"missed")
+			}
+
+			err := stream.Send(&whatsatrpc.MessageEvent{
+				Type:    marshallEventType(event.Type),
+				Message: marshallMessage(event.Message),
+			})
+			if err != nil {
+				return err
+			}
+
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// ListConversations returns one summary per peer.
+func (s *rpcServer) ListConversations(ctx context.Context,
+	req *whatsatrpc.ListConversationsRequest) (
+	*whatsatrpc.ListConversationsResponse, error) {
+
+	resp := &whatsatrpc.ListConversationsResponse{}
+	for _, c := range s.store.conversations() {
+		resp.Conversations = append(
+			resp.Conversations, &whatsatrpc.Conversation{
+				Peer:        c.Peer,
+				Alias:       c.Alias,
+				Messages:    uint32(c.Messages),
+				BalanceMsat: c.BalanceMsat,
+				LastMessage: marshallMessage(c.LastMessage),
+			},
+		)
+	}
+
+	return resp, nil
+}
+
+// GetHistory returns the messages exchanged with a peer.
+func (s *rpcServer) GetHistory(ctx context.Context,
+	req *whatsatrpc.GetHistoryRequest) (*whatsatrpc.GetHistoryResponse,
+	error) {
+
+	var peer *route.Vertex
+	if req.Peer != "" {
+		p, err := s.store.contacts.resolve(req.Peer)
+		if err != nil {
+			return nil, status.Error(
+				codes.InvalidArgument, err.Error(),
+			)
+		}
+		peer = &p
+	}
+
+	resp := &whatsatrpc.GetHistoryResponse{}
+	for _, msg := range s.store.history(peer) {
+		resp.Messages = append(resp.Messages, marshallMessage(msg))
+	}
+
+	return resp, nil
+}
+
+// AddContact stores a name for a peer.
+func (s *rpcServer) AddContact(ctx context.Context,
+	req *whatsatrpc.AddContactRequest) (*whatsatrpc.Contact, error) {
+
+	c, err := s.store.contacts.add(req.Name, req.Peer)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return marshallContact(c), nil
+}
+
+// RemoveContact deletes a contact.
+func (s *rpcServer) RemoveContact(ctx context.Context,
+	req *whatsatrpc.RemoveContactRequest) (
+	*whatsatrpc.RemoveContactResponse, error) {
+
+	if err := s.store.contacts.remove(req.Name); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &whatsatrpc.RemoveContactResponse{}, nil
+}
+
+// ListContacts returns all contacts.
+func (s *rpcServer) ListContacts(ctx context.Context,
+	req *whatsatrpc.ListContactsRequest) (*whatsatrpc.ListContactsResponse,
+	error) {
+
+	resp := &whatsatrpc.ListContactsResponse{}
+	for _, c := range s.store.contacts.list() {
+		resp.Contacts = append(resp.Contacts, marshallContact(c))
+	}
+
+	return resp, nil
+}
+
+func marshallMessage(msg *storedMessage) *whatsatrpc.Message {
+	state := whatsatrpc.MessageState_PENDING
+	switch msg.State {
+	case stateDelivered.String():
+		state = whatsatrpc.MessageState_DELIVERED
+	case stateFailed.String():
+		state = whatsatrpc.MessageState_FAILED
+	}
+
+	return &whatsatrpc.Message{
+		Id:          msg.ID,
+		Peer:        msg.Peer,
+		Alias:       msg.Alias,
+		Outgoing:    msg.Outgoing,
+		Text:        msg.Text,
+		TimestampNs: msg.Timestamp.UnixNano(),
+		State:       state,
+		FeeMsat:     msg.FeeMsat,
+		AmtMsat:     msg.AmtMsat,
+	}
+}
+
+func marshallEventType(eventType string) whatsatrpc.MessageEvent_EventType {
+	switch eventType {
+	case eventSent:
+		return whatsatrpc.MessageEvent_SENT
+	case eventDelivery:
+		return whatsatrpc.MessageEvent_DELIVERY
+	default:
+		return whatsatrpc.MessageEvent_RECEIVED
+	}
+}
+
+func marshallContact(c *contact) *whatsatrpc.Contact {
+	return &whatsatrpc.Contact{
+		Name:    c.Name,
+		PubKey:  c.PubKey,
+		Address: c.Address,
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/signrpc"
+	"github.com/lightningnetwork/lnd/routing/route"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"whatsat/whatsatrpc"
+)
+
+const (
+	testSelfKey = "02aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testPeerKey = "03bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+
+	testTimeout = 5 * time.Second
+)
+
+// fakeLnd implements the parts of the lnd api that the chat engine uses. Calls
+// to other methods panic through the nil embedded interfaces.
+type fakeLnd struct {
+	lnrpc.LightningServer
+
+	// payments receives the payment requests that are sent.
+	payments chan *routerrpc.SendPaymentRequest
+
+	// invoices is the stream of settled invoices.
+	invoices chan *lnrpc.Invoice
+
+	// routeFee is the fee in msat of the routes to the test peer. It is
+	// accessed atomically.
+	routeFee int64
+}
+
+// fakeRouter is the router sub-server of the fake lnd.
+type fakeRouter struct {
+	routerrpc.RouterServer
+
+	lnd *fakeLnd
+}
+
+// fakeSigner is the signer sub-server of the fake lnd. Only the signature
+// "sig" is valid.
+type fakeSigner struct {
+	signrpc.SignerServer
+}
+
+func (f *fakeLnd) GetInfo(context.Context,
+	*lnrpc.GetInfoRequest) (*lnrpc.GetInfoResponse, error) {
+
+	return &lnrpc.GetInfoResponse{IdentityPubkey: testSelfKey}, nil
+}
+
+func (f *fakeLnd) DescribeGraph(context.Context,
+	*lnrpc.ChannelGraphRequest) (*lnrpc.ChannelGraph, error) {
+
+	return &lnrpc.ChannelGraph{
+		Nodes: []*lnrpc.LightningNode{
+			{PubKey: testSelfKey, Alias: "self"},
+			{PubKey: testPeerKey, Alias: "bob"},
+		},
+	}, nil
+}
+
+// QueryRoutes only finds routes to the test peer.
+func (f *fakeLnd) QueryRoutes(_ context.Context,
+	req *lnrpc.QueryRoutesRequest) (*lnrpc.QueryRoutesResponse, error) {
+
+	if req.PubKey != testPeerKey {
+		return nil, fmt.Errorf("unable to find a path to destination")
+	}
+
+	return &lnrpc.QueryRoutesResponse{
+		Routes: []*lnrpc.Route{{
+			TotalFeesMsat: atomic.LoadInt64(&f.routeFee),
+			Hops:          []*lnrpc.Hop{{}, {}},
+		}},
+	}, nil
+}
+
+func (f *fakeLnd) SubscribeInvoices(req *lnrpc.InvoiceSubscription,
+	stream lnrpc.Lightning_SubscribeInvoicesServer) error {
+
+	for {
+		select {
+		case invoice := <-f.invoices:
+			if err := stream.Send(invoice); err != nil {
+				return err
+			}
+
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// SendPayment reports the payment in flight and then delivered with a fee of
+// 5 msat.
+func (f *fakeRouter) SendPayment(req *routerrpc.SendPaymentRequest,
+	stream routerrpc.Router_SendPaymentServer) error {
+
+	f.lnd.payments <- req
+
+	err := stream.Send(&routerrpc.PaymentStatus{
+		State: routerrpc.PaymentState_IN_FLIGHT,
+	})
+	if err != nil {
+		return err
+	}
+
+	return stream.Send(&routerrpc.PaymentStatus{
+		State: routerrpc.PaymentState_SUCCEEDED,
+		Route: &lnrpc.Route{TotalFeesMsat: 5},
+	})
+}
+
+func (f *fakeSigner) SignMessage(context.Context,
+	*signrpc.SignMessageReq) (*signrpc.SignMessageResp, error) {
+
+	return &signrpc.SignMessageResp{Signature: []byte("sig")}, nil
+}
+
+func (f *fakeSigner) VerifyMessage(_ context.Context,
+	req *signrpc.VerifyMessageReq) (*signrpc.VerifyMessageResp, error) {
+
+	return &signrpc.VerifyMessageResp{
+		Valid: string(req.Signature) == "sig",
+	}, nil
+}
+
+// serve starts a grpc server on a local port and returns its address.
+func serve(t *testing.T, server *grpc.Server) string {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	return listener.Addr().String()
+}
+
+// testEngine sets up the global chat engine on a fake lnd.
+func testEngine(t *testing.T) (*fakeLnd, func()) {
+	lnd := &fakeLnd{
+		payments: make(chan *routerrpc.SendPaymentRequest, 10),
+		invoices: make(chan *lnrpc.Invoice, 10),
+	}
+	lndServer := grpc.NewServer()
+	lnrpc.RegisterLightningServer(lndServer, lnd)
+	routerrpc.RegisterRouterServer(lndServer, &fakeRouter{lnd: lnd})
+	signrpc.RegisterSignerServer(lndServer, &fakeSigner{})
+
+	lndConn, err := grpc.Dial(serve(t, lndServer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err = newChatEngine(lndConn, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanUp := func() {
+		lndConn.Close()
+		lndServer.Stop()
+	}
+
+	return lnd, cleanUp
+}
+
+// testDaemon runs the grpc service of the daemon against a fake lnd and
+// returns an authenticated client.
+func testDaemon(t *testing.T) (whatsatrpc.WhatsatClient, *fakeLnd,
+	*messageStore, func()) {
+
+	lnd, stopLnd := testEngine(t)
+
+	dir, err := ioutil.TempDir("", "whatsat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contacts, err := loadContacts(filepath.Join(dir, contactsFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newMessageStore(engine, contacts)
+
+	receiveCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_ = engine.receive(
+			receiveCtx, store.addReceived, store.sendReply,
+		)
+	}()
+
+	rpcServer := newGrpcServer(store, "token")
+	rpcConn, err := grpc.Dial(serve(t, rpcServer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanUp := func() {
+		cancel()
+		rpcConn.Close()
+		rpcServer.Stop()
+		stopLnd()
+		os.RemoveAll(dir)
+	}
+
+	return whatsatrpc.NewWhatsatClient(rpcConn), lnd, store, cleanUp
+}
+
+func authContext() (context.Context, func()) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	ctx = metadata.AppendToOutgoingContext(
+		ctx, "authorization", "Bearer token",
+	)
+
+	return ctx, cancel
+}
+
+// waitForSubscriber waits until the stream is registered with the store, so
+// that no events are missed.
+func waitForSubscriber(t *testing.T, store *messageStore) {
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		store.mtx.Lock()
+		n := len(store.subscribers)
+		store.mtx.Unlock()
+
+		if n > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("no subscriber")
+}
+
+func TestGrpcAuth(t *testing.T) {
+	client, _, _, cleanUp := testDaemon(t)
+	defer cleanUp()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	_, err := client.ListContacts(ctx, &whatsatrpc.ListContactsRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected unauthenticated, got %v", err)
+	}
+}
+
+func TestGrpcSendMessage(t *testing.T) {
+	client, lnd, store, cleanUp := testDaemon(t)
+	defer cleanUp()
+
+	ctx, cancel := authContext()
+	defer cancel()
+
+	events, err := client.SubscribeMessages(
+		ctx, &whatsatrpc.SubscribeMessagesRequest{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForSubscriber(t, store)
+
+	msg, err := client.SendMessage(ctx, &whatsatrpc.SendMessageRequest{
+		Peer: "bob",
+		Text: "hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Peer != testPeerKey || msg.Text != "hello" || !msg.Outgoing ||
+		msg.State != whatsatrpc.MessageState_PENDING {
+
+		t.Fatalf("unexpected message: %v", msg)
+	}
+
+	select {
+	case req := <-lnd.payments:
+		if string(req.DestCustomRecords[tlvMsgRecord]) != "hello" {
+			t.Fatalf("unexpected message record: %v",
+				req.DestCustomRecords[tlvMsgRecord])
+		}
+		if req.AmtMsat != 1000 {
+			t.Fatalf("expected 1000 msat, got %v", req.AmtMsat)
+		}
+
+	case <-time.After(testTimeout):
+		t.Fatal("no payment")
+	}
+
+	event, err := events.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != whatsatrpc.MessageEvent_SENT ||
+		event.Message.Id != msg.Id {
+
+		t.Fatalf("unexpected event: %v", event)
+	}
+
+	event, err = events.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != whatsatrpc.MessageEvent_DELIVERY ||
+		event.Message.State != whatsatrpc.MessageState_DELIVERED ||
+		event.Message.FeeMsat != 5 {
+
+		t.Fatalf("unexpected event: %v", event)
+	}
+
+	history, err := client.GetHistory(ctx, &whatsatrpc.GetHistoryRequest{
+		Peer: testPeerKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Messages) != 1 ||
+		history.Messages[0].State != whatsatrpc.MessageState_DELIVERED {
+
+		t.Fatalf("unexpected history: %v", history.Messages)
+	}
+}
+
+func TestGrpcReceiveMessage(t *testing.T) {
+	client, lnd, store, cleanUp := testDaemon(t)
+	defer cleanUp()
+
+	ctx, cancel := authContext()
+	defer cancel()
+
+	events, err := client.SubscribeMessages(
+		ctx, &whatsatrpc.SubscribeMessagesRequest{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForSubscriber(t, store)
+
+	sender, err := route.NewVertexFromStr(testPeerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := time.Unix(1576000000, 0)
+	var timeBuffer [8]byte
+	byteOrder.PutUint64(timeBuffer[:], uint64(timestamp.UnixNano()))
+
+	records := map[uint64][]byte{
+		tlvMsgRecord:    []byte("hi there"),
+		tlvSigRecord:    []byte("sig"),
+		tlvSenderRecord: sender[:],
+		tlvTimeRecord:   timeBuffer[:],
+	}
+
+	// An invoice with an invalid signature is ignored.
+	badRecords := make(map[uint64][]byte)
+	for k, v := range records {
+		badRecords[k] = v
+	}
+	badRecords[tlvSigRecord] = []byte("forged")
+	badRecords[tlvMsgRecord] = []byte("forged")
+
+	for _, r := range []map[uint64][]byte{badRecords, records} {
+		lnd.invoices <- &lnrpc.Invoice{
+			State:       lnrpc.Invoice_SETTLED,
+			AmtPaidMsat: 2000,
+			Htlcs: []*lnrpc.InvoiceHTLC{{
+				State:         lnrpc.InvoiceHTLCState_SETTLED,
+				CustomRecords: r,
+			}},
+		}
+	}
+
+	event, err := events.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := event.Message
+	if event.Type != whatsatrpc.MessageEvent_RECEIVED ||
+		msg.Text != "hi there" || msg.Peer != testPeerKey ||
+		msg.Alias != "bob" || msg.AmtMsat != 2000 ||
+		msg.TimestampNs != timestamp.UnixNano() {
+
+		t.Fatalf("unexpected event: %v", event)
+	}
+
+	conversations, err := client.ListConversations(
+		ctx, &whatsatrpc.ListConversationsRequest{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations.Conversations) != 1 ||
+		conversations.Conversations[0].BalanceMsat != 2000 {
+
+		t.Fatalf("unexpected conversations: %v",
+			conversations.Conversations)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+// maxRequestSize is the maximum size of a request body that the api accepts.
+const maxRequestSize = 64 * 1024
+
+// restServer serves the HTTP/JSON api of the daemon.
+type restServer struct {
+	store *messageStore
+	token string
+	mux   *http.ServeMux
+
+	// quit is closed when the server shuts down, to end the event
+	// streams that would otherwise keep their connections open.
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+func newRestServer(store *messageStore, token string) *restServer {
+	s := &restServer{
+		store: store,
+		token: token,
+		mux:   http.NewServeMux(),
+		quit:  make(chan struct{}),
+	}
+
+	s.mux.HandleFunc("/messages", s.handleMessages)
+	s.mux.HandleFunc("/conversations", s.handleConversations)
+	s.mux.HandleFunc("/events", s.handleEvents)
+
+	return s
+}
+
+// stop ends the event streams. It is registered to run on shutdown of the
+// http server.
+func (s *restServer) stop() {
+	s.quitOnce.Do(func() {
+		close(s.quit)
+	})
+}
+
+// ServeHTTP checks the bearer token and dispatches the request.
+func (s *restServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare(
+			[]byte(strings.TrimPrefix(auth, "Bearer ")),
+			[]byte(s.token),
+		) != 1 {
+
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// sendRequest is the body of a POST /messages request.
+type sendRequest struct {
+	Peer string `json:"peer"`
+	Text string `json:"text"`
+}
+
+func (s *restServer) handleMessages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var peer *route.Vertex
+		if peerStr := r.URL.Query().Get("peer"); peerStr != "" {
+			p, err := s.store.contacts.resolve(peerStr)
+			if err != nil {
+				writeError(w, http.StatusBadRequest,
+					"invalid peer: %v", err)
+				return
+			}
+			peer = &p
+		}
+
+		writeJSON(w, http.StatusOK, s.store.history(peer))
+
+	case http.MethodPost:
+		var req sendRequest
+		decoder := json.NewDecoder(
+			http.MaxBytesReader(w, r.Body, maxRequestSize),
+		)
+		if err := decoder.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest,
+				"invalid request: %v", err)
+			return
+		}
+		if req.Text == "" {
+			writeError(w, http.StatusBadRequest, "empty message")
+			return
+		}
+
+		dest, err := s.store.contacts.resolve(req.Peer)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+
+		msg, err := s.store.send(dest, req.Text)
+		if err == errVetoed {
+			writeError(w, http.StatusForbidden, "%v", err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+
+		writeJSON(w, http.StatusAccepted, msg)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *restServer) handleConversations(w http.ResponseWriter,
+	r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.store.conversations())
+}
+
+// handleEvents streams message events to the client as server-sent events
+// until the client disconnects or the server shuts down. A client that can't
+// keep up is disconnected and should reload the history from /messages after
+// reconnecting.
+func (s *restServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError,
+			"streaming not supported")
+		return
+	}
+
+	events, cancel := s.store.subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			b, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+
+			_, err = fmt.Fprintf(
+				w, "event: %v\ndata: %s\n\n", event.Type, b,
+			)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	_ = encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string,
+	args ...interface{}) {
+
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{
+		Error: fmt.Sprintf(format, args...),
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/urfave/cli"
+)
+
+// forwardingPolicy is a channel policy that we set on our own channels.
+type forwardingPolicy struct {
+	baseFeeMsat   int64
+	feeRatePpm    int64
+	timeLockDelta uint32
+	minHtlcMsat   uint64
+	maxHtlcMsat   uint64
+}
+
+// chatPolicyFlags are the flags to configure the chat-friendly forwarding
+// policy. The defaults charge a 1 msat fixed fee and allow amounts from 1 msat.
+// The maximum htlc amount is left unchanged unless it is set, so that channels
+// can still forward regular payments.
+var chatPolicyFlags = []cli.Flag{
+	cli.Int64Flag{
+		Name:  "base_fee_msat",
+		Usage: "base fee of the chat policy",
+		Value: 1,
+	},
+	cli.Int64Flag{
+		Name:  "fee_rate_ppm",
+		Usage: "fee rate in millionths of the chat policy",
+		Value: 0,
+	},
+	cli.Uint64Flag{
+		Name:  "time_lock_delta",
+		Usage: "cltv delta of the chat policy",
+		Value: 40,
+	},
+	cli.Uint64Flag{
+		Name:  "min_htlc_msat",
+		Usage: "minimum htlc amount of the chat policy",
+		Value: 1,
+	},
+	cli.Uint64Flag{
+		Name: "max_htlc_msat",
+		Usage: "maximum htlc amount of the chat policy (0 leaves " +
+			"it unchanged)",
+	},
+}
+
+// getChatPolicy returns the chat policy configured through chatPolicyFlags.
+func getChatPolicy(ctx *cli.Context) *forwardingPolicy {
+	return &forwardingPolicy{
+		baseFeeMsat:   ctx.Int64("base_fee_msat"),
+		feeRatePpm:    ctx.Int64("fee_rate_ppm"),
+		timeLockDelta: uint32(ctx.Uint64("time_lock_delta")),
+		minHtlcMsat:   ctx.Uint64("min_htlc_msat"),
+		maxHtlcMsat:   ctx.Uint64("max_htlc_msat"),
+	}
+}
+
+func (p *forwardingPolicy) String() string {
+	maxHtlc := "unchanged"
+	if p.maxHtlcMsat != 0 {
+		maxHtlc = fmt.Sprintf("%v msat", p.maxHtlcMsat)
+	}
+
+	return fmt.Sprintf("base fee %v msat, fee rate %v ppm, time lock "+
+		"delta %v, min htlc %v msat, max htlc %v", p.baseFeeMsat,
+		p.feeRatePpm, p.timeLockDelta, p.minHtlcMsat, maxHtlc)
+}
+
+// updateRequest returns the request to set the policy on a channel.
+func (p *forwardingPolicy) updateRequest(
+	chanPoint *lnrpc.ChannelPoint) *lnrpc.PolicyUpdateRequest {
+
+	return &lnrpc.PolicyUpdateRequest{
+		Scope: &lnrpc.PolicyUpdateRequest_ChanPoint{
+			ChanPoint: chanPoint,
+		},
+		BaseFeeMsat:          p.baseFeeMsat,
+		FeeRate:              float64(p.feeRatePpm) / 1000000,
+		TimeLockDelta:        p.timeLockDelta,
+		MinHtlcMsat:          p.minHtlcMsat,
+		MinHtlcMsatSpecified: true,
+
+		// Zero leaves the maximum htlc amount unchanged.
+		MaxHtlcMsat: p.maxHtlcMsat,
+	}
+}
@@ -18,6 +18,7 @@ require (
 	github.com/roasbeef/btcwallet v0.0.0-20180426223453-30affec83c18 // indirect
 	github.com/tv42/zbase32 v0.0.0-20160707012821-501572607d02
 	github.com/urfave/cli v1.22.2
+	go.starlark.net v0.0.0-20190702223751-32f345186213
 	golang.org/x/crypto v0.0.0-20191206172530-e9b2fee46413
 	google.golang.org/grpc v1.25.1
 	gopkg.in/macaroon.v2 v2.1.0
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+	"github.com/urfave/cli"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+const (
+	hooksDirname = "hooks"
+
+	hooksLogFilename = "hooks.log"
+
+	hookBeforeSend = "before_send"
+	hookReceive    = "on_receive"
+	hookDelivered  = "on_delivered"
+	hookFailed     = "on_failed"
+
+	// hookTimeout is how long a hook function may run. A script that
+	// exceeds it is cancelled and disabled until the next start.
+	hookTimeout = 5 * time.Second
+
+	// hookCancelKey is the thread-local key of the flag that is set when
+	// a hook call is cancelled.
+	hookCancelKey = "cancelled"
+
+	// hookReplyLimit is the number of replies that the receive hooks may
+	// send to a peer within hookReplyInterval. It stops two nodes with
+	// auto replies from replying to each other forever.
+	hookReplyLimit    = 3
+	hookReplyInterval = time.Minute
+)
+
+// errVetoed is returned when sending a message is refused by a hook.
+var errVetoed = errors.New("message vetoed by hook")
+
+// hooks holds the scripts that are loaded from the data directory. It is nil
+// when there are none.
+var hooks *scriptHooks
+
+// hookScript is a loaded starlark script with the functions it defines.
+type hookScript struct {
+	name    string
+	globals starlark.StringDict
+
+	// disabled is set when a hook function of the script timed out.
+	disabled bool
+}
+
+// scriptHooks runs the hook functions of the scripts on message events. Calls
+// are serialized, so that the scripts see one event at a time. The globals of
+// a script are frozen after loading, so hooks can't keep state between calls.
+type scriptHooks struct {
+	mtx     sync.Mutex
+	scripts []*hookScript
+
+	// timeout is how long a hook function may run.
+	timeout time.Duration
+
+	// replies holds the times of the recent replies to each peer.
+	replies map[route.Vertex][]time.Time
+
+	// logger receives the output of print() and errors raised by the
+	// scripts. A terminal can't be used, because it may be owned by the
+	// chat interface.
+	logger *log.Logger
+}
+
+// initHooks loads the *.star scripts from the hooks directory in the data
+// directory.
+func initHooks(ctx *cli.Context) error {
+	dir := filepath.Join(getDataDir(ctx), hooksDirname)
+
+	var err error
+	hooks, err = loadHooks(dir)
+	return err
+}
+
+// loadHooks executes the scripts in the directory in lexical order. Nil is
+// returned if there are no scripts.
+func loadHooks(dir string) (*scriptHooks, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.star"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	logFile, err := os.OpenFile(
+		filepath.Join(dir, hooksLogFilename),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &scriptHooks{
+		timeout: hookTimeout,
+		replies: make(map[route.Vertex][]time.Time),
+		logger:  log.New(logFile, "", log.LstdFlags),
+	}
+
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		name := filepath.Base(file)
+		globals, err := starlark.ExecFile(
+			h.newThread(name), name, src, hookPredeclared,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load hook %v: %v", name,
+				err)
+		}
+
+		h.scripts = append(h.scripts, &hookScript{
+			name:    name,
+			globals: globals,
+		})
+	}
+
+	return h, nil
+}
+
+func (h *scriptHooks) newThread(name string) *starlark.Thread {
+	return &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			h.logger.Printf("%v: %v", name, msg)
+		},
+	}
+}
+
+// hookPredeclared replaces the range builtin for the scripts. Starlark has no
+// way to interrupt a running function, and without while loops and recursion
+// only for loops can keep a function busy for long. Loops over the ranges that
+// a hook function creates stop when the call is cancelled, so that a timed out
+// function ends instead of spinning in the background. Loops over lists still
+// run to their end.
+var hookPredeclared = starlark.StringDict{
+	"range": starlark.NewBuiltin("range", hookRange),
+}
+
+// hookRange returns a range that stops iterating when the hook call that
+// created it is cancelled.
+func hookRange(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	r, err := starlark.Call(
+		thread, starlark.Universe["range"], args, kwargs,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ranges that are created while loading the script can't be
+	// cancelled.
+	cancelled, ok := thread.Local(hookCancelKey).(*int32)
+	if !ok {
+		return r, nil
+	}
+
+	return &cancelableRange{
+		Sliceable: r.(starlark.Sliceable),
+		cancelled: cancelled,
+	}, nil
+}
+
+// cancelableRange is a range whose iterators stop when the flag is set.
+type cancelableRange struct {
+	starlark.Sliceable
+	cancelled *int32
+}
+
+// Binary implements the in operator, which the interpreter only knows for
+// the builtin range.
+func (r *cancelableRange) Binary(op syntax.Token, y starlark.Value,
+	side starlark.Side) (starlark.Value, error) {
+
+	if op != syntax.IN || side != starlark.Right {
+		return nil, nil
+	}
+
+	return starlark.Binary(op, y, r.Sliceable)
+}
+
+// CompareSameType compares the ranges like the builtin ranges.
+func (r *cancelableRange) CompareSameType(op syntax.Token, y starlark.Value,
+	depth int) (bool, error) {
+
+	return starlark.CompareDepth(
+		op, r.Sliceable, y.(*cancelableRange).Sliceable, depth,
+	)
+}
+
+func (r *cancelableRange) Iterate() starlark.Iterator {
+	return &cancelableIterator{
+		Iterator:  starlark.Iterate(r.Sliceable),
+		cancelled: r.cancelled,
+	}
+}
+
+type cancelableIterator struct {
+	starlark.Iterator
+	cancelled *int32
+}
+
+func (it *cancelableIterator) Next(p *starlark.Value) bool {
+	if atomic.LoadInt32(it.cancelled) != 0 {
+		return false
+	}
+
+	return it.Iterator.Next(p)
+}
+
+// call runs the hook function of the script, if it defines it. Errors are
+// logged and reported as a nil result, so that a broken script doesn't stop
+// the chat. A function that doesn't return within the timeout is cancelled and
+// its script is disabled.
+func (h *scriptHooks) call(script *hookScript, hook string,
+	msg starlark.StringDict) starlark.Value {
+
+	fn, ok := script.globals[hook]
+	if !ok || script.disabled {
+		return nil
+	}
+
+	arg := starlarkstruct.FromStringDict(starlark.String("message"), msg)
+
+	type callResult struct {
+		value starlark.Value
+		err   error
+	}
+	var cancelled int32
+	thread := h.newThread(script.name)
+	thread.SetLocal(hookCancelKey, &cancelled)
+
+	done := make(chan callResult, 1)
+	go func() {
+		value, err := starlark.Call(
+			thread, fn, starlark.Tuple{arg}, nil,
+		)
+		done <- callResult{value, err}
+	}()
+
+	var result callResult
+	select {
+	case result = <-done:
+	case <-time.After(h.timeout):
+		h.logger.Printf("%v: %v didn't finish within %v, script "+
+			"disabled", script.name, hook, h.timeout)
+		atomic.StoreInt32(&cancelled, 1)
+		script.disabled = true
+		return nil
+	}
+
+	if err := result.err; err != nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			err = errors.New(evalErr.Backtrace())
+		}
+		h.logger.Printf("%v: %v failed: %v", script.name, hook, err)
+		return nil
+	}
+
+	return result.value
+}
+
+// beforeSend passes an outgoing message through the before_send hooks. Each
+// hook may return a replacement text, or False or an empty string to veto the
+// message. The text that is to be sent is returned.
+func (h *scriptHooks) beforeSend(dest route.Vertex, text string,
+	amtMsat int64) (string, error) {
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for _, script := range h.scripts {
+		result := h.call(script, hookBeforeSend, starlark.StringDict{
+			"peer":     starlark.String(dest.String()),
+			"alias":    starlark.String(keyToAlias[dest]),
+			"text":     starlark.String(text),
+			"amt_msat": starlark.MakeInt64(amtMsat),
+		})
+
+		switch r := result.(type) {
+		case nil, starlark.NoneType:
+
+		case starlark.String:
+			if r == "" {
+				h.logger.Printf("%v: vetoed message to %v",
+					script.name, dest)
+				return "", errVetoed
+			}
+			text = string(r)
+
+		case starlark.Bool:
+			if !r {
+				h.logger.Printf("%v: vetoed message to %v",
+					script.name, dest)
+				return "", errVetoed
+			}
+
+		default:
+			h.logger.Printf("%v: %v returned %v, expected a "+
+				"string, bool or None", script.name,
+				hookBeforeSend, result.Type())
+		}
+	}
+
+	return text, nil
+}
+
+// received runs the on_receive hooks for an incoming message. The strings
+// that the hooks return are returned as replies to the sender, as far as the
+// reply limit allows.
+func (h *scriptHooks) received(msg *receivedMessage) []string {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	var replies []string
+	for _, script := range h.scripts {
+		result := h.call(script, hookReceive, starlark.StringDict{
+			"peer":      starlark.String(msg.sender.String()),
+			"alias":     starlark.String(keyToAlias[msg.sender]),
+			"text":      starlark.String(msg.text),
+			"amt_msat":  starlark.MakeInt64(msg.amtMsat),
+			"timestamp": starlark.MakeInt64(msg.timestamp.Unix()),
+		})
+
+		switch r := result.(type) {
+		case nil, starlark.NoneType:
+
+		case starlark.String:
+			if r == "" {
+				break
+			}
+			if !h.allowReply(msg.sender, time.Now()) {
+				h.logger.Printf("%v: reply limit for %v "+
+					"reached, dropped reply", script.name,
+					msg.sender)
+				break
+			}
+			replies = append(replies, string(r))
+
+		default:
+			h.logger.Printf("%v: %v returned %v, expected a "+
+				"string or None", script.name, hookReceive,
+				result.Type())
+		}
+	}
+
+	return replies
+}
+
+// allowReply records a reply to the peer at the given time and returns whether
+// it is within the reply limit. The caller must hold the mutex.
+func (h *scriptHooks) allowReply(peer route.Vertex, now time.Time) bool {
+	// Drop the replies that fell out of the window.
+	cutoff := now.Add(-hookReplyInterval)
+	recent := h.replies[peer][:0]
+	for _, t := range h.replies[peer] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+
+	if len(recent) >= hookReplyLimit {
+		h.replies[peer] = recent
+		return false
+	}
+
+	h.replies[peer] = append(recent, now)
+
+	return true
+}
+
+// delivered runs the on_delivered or on_failed hooks for the final state of an
+// outgoing message.
+func (h *scriptHooks) delivered(dest route.Vertex, text string,
+	amtMsat int64, u *deliveryUpdate) {
+
+	hook := hookDelivered
+	if u.state == stateFailed {
+		hook = hookFailed
+	}
+
+	msg := starlark.StringDict{
+		"peer":     starlark.String(dest.String()),
+		"alias":    starlark.String(keyToAlias[dest]),
+		"text":     starlark.String(text),
+		"amt_msat": starlark.MakeInt64(amtMsat),
+		"fee_msat": starlark.MakeInt64(u.fee),
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for _, script := range h.scripts {
+		h.call(script, hook, msg)
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/routing/route"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"whatsat/whatsatrpc"
+)
+
+// testHooks loads the scripts, given by file name, from a temporary hooks
+// directory. The returned function reads the hooks log.
+func testHooks(t *testing.T, scripts map[string]string) (*scriptHooks,
+	func() string, func()) {
+
+	dir, err := ioutil.TempDir("", "whatsat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, src := range scripts {
+		err := ioutil.WriteFile(
+			filepath.Join(dir, name), []byte(src), 0600,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err := loadHooks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readLog := func() string {
+		log, err := ioutil.ReadFile(filepath.Join(dir, hooksLogFilename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(log)
+	}
+
+	return h, readLog, func() { os.RemoveAll(dir) }
+}
+
+func testPeer(t *testing.T) route.Vertex {
+	peer, err := route.NewVertexFromStr(testPeerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return peer
+}
+
+func TestLoadHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whatsat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := loadHooks(dir)
+	if err != nil || h != nil {
+		t.Fatalf("expected no hooks, got %v, %v", h, err)
+	}
+
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "broken.star"), []byte("def on_receive(:"),
+		0600,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = loadHooks(dir)
+	if err == nil || !strings.Contains(err.Error(), "broken.star") {
+		t.Fatalf("expected load error, got %v", err)
+	}
+}
+
+func TestHooksBeforeSend(t *testing.T) {
+	h, _, cleanUp := testHooks(t, map[string]string{
+		"1_upper.star": `
+def before_send(msg):
+    if msg.text == "secret":
+        return False
+    if msg.text == "empty":
+        return ""
+    if msg.text == "keep":
+        return None
+    return msg.text.upper()
+`,
+		"2_sign.star": `
+def before_send(msg):
+    return msg.text + " -- " + str(msg.amt_msat)
+`,
+	})
+	defer cleanUp()
+
+	peer := testPeer(t)
+
+	text, err := h.beforeSend(peer, "hello", 1000)
+	if err != nil || text != "HELLO -- 1000" {
+		t.Fatalf("unexpected result: %q, %v", text, err)
+	}
+
+	text, err = h.beforeSend(peer, "keep", 1000)
+	if err != nil || text != "keep -- 1000" {
+		t.Fatalf("unexpected result: %q, %v", text, err)
+	}
+
+	for _, vetoed := range []string{"secret", "empty"} {
+		_, err := h.beforeSend(peer, vetoed, 1000)
+		if err != errVetoed {
+			t.Fatalf("%v: expected veto, got %v", vetoed, err)
+		}
+	}
+}
+
+func TestHooksReceived(t *testing.T) {
+	h, readLog, cleanUp := testHooks(t, map[string]string{
+		"echo.star": `
+def on_receive(msg):
+    if msg.text.startswith("!"):
+        return "echo " + msg.text[1:]
+`,
+	})
+	defer cleanUp()
+
+	peer := testPeer(t)
+	receive := func(text string) []string {
+		return h.received(&receivedMessage{
+			sender:    peer,
+			text:      text,
+			timestamp: time.Now(),
+		})
+	}
+
+	if replies := receive("hi"); len(replies) != 0 {
+		t.Fatalf("unexpected replies: %q", replies)
+	}
+
+	replies := receive("!hi")
+	if !reflect.DeepEqual(replies, []string{"echo hi"}) {
+		t.Fatalf("unexpected replies: %q", replies)
+	}
+
+	// Replies beyond the limit are dropped.
+	for i := 1; i < hookReplyLimit; i++ {
+		if replies := receive("!again"); len(replies) != 1 {
+			t.Fatalf("reply %v dropped", i)
+		}
+	}
+	if replies := receive("!again"); len(replies) != 0 {
+		t.Fatalf("reply limit exceeded: %q", replies)
+	}
+	if !strings.Contains(readLog(), "reply limit") {
+		t.Fatal("dropped reply not logged")
+	}
+}
+
+func TestHooksReplyLimit(t *testing.T) {
+	h := &scriptHooks{
+		replies: make(map[route.Vertex][]time.Time),
+	}
+
+	peer := testPeer(t)
+	now := time.Now()
+
+	for i := 0; i < hookReplyLimit; i++ {
+		if !h.allowReply(peer, now) {
+			t.Fatalf("reply %v not allowed", i)
+		}
+	}
+	if h.allowReply(peer, now) {
+		t.Fatal("reply limit exceeded")
+	}
+	if h.allowReply(peer, now.Add(hookReplyInterval-time.Second)) {
+		t.Fatal("reply limit exceeded within interval")
+	}
+	if !h.allowReply(peer, now.Add(hookReplyInterval)) {
+		t.Fatal("reply not allowed after interval")
+	}
+}
+
+func TestHooksBrokenScript(t *testing.T) {
+	h, readLog, cleanUp := testHooks(t, map[string]string{
+		"1_broken.star": `
+def before_send(msg):
+    fail("broken hook")
+
+def on_receive(msg):
+    return 42
+`,
+		"2_ok.star": `
+def before_send(msg):
+    print("sending", msg.text)
+    return msg.text + "!"
+`,
+	})
+	defer cleanUp()
+
+	peer := testPeer(t)
+
+	// The broken script is skipped and the others still run.
+	text, err := h.beforeSend(peer, "hello", 1000)
+	if err != nil || text != "hello!" {
+		t.Fatalf("unexpected result: %q, %v", text, err)
+	}
+
+	replies := h.received(&receivedMessage{sender: peer, text: "hi"})
+	if len(replies) != 0 {
+		t.Fatalf("unexpected replies: %q", replies)
+	}
+
+	log := readLog()
+	for _, expected := range []string{
+		"1_broken.star: before_send failed", "broken hook",
+		"on_receive returned int", "2_ok.star: sending hello",
+	} {
+		if !strings.Contains(log, expected) {
+			t.Fatalf("%q missing in log:\n%v", expected, log)
+		}
+	}
+}
+
+func TestHooksTimeout(t *testing.T) {
+	h, readLog, cleanUp := testHooks(t, map[string]string{
+		"slow.star": `
+def before_send(msg):
+    for i in range(2000000000):
+        pass
+    print("stopped")
+    return "late"
+`,
+	})
+	defer cleanUp()
+
+	h.timeout = 50 * time.Millisecond
+
+	peer := testPeer(t)
+
+	text, err := h.beforeSend(peer, "hello", 1000)
+	if err != nil || text != "hello" {
+		t.Fatalf("unexpected result: %q, %v", text, err)
+	}
+	if !h.scripts[0].disabled {
+		t.Fatal("slow script not disabled")
+	}
+	if !strings.Contains(readLog(), "didn't finish") {
+		t.Fatal("timeout not logged")
+	}
+
+	// The loop of the cancelled call ends.
+	deadline := time.Now().Add(testTimeout)
+	for !strings.Contains(readLog(), "stopped") {
+		if time.Now().After(deadline) {
+			t.Fatal("cancelled hook still running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The disabled script isn't called again.
+	start := time.Now()
+	if _, err := h.beforeSend(peer, "hello", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) >= h.timeout {
+		t.Fatal("disabled script called")
+	}
+}
+
+// TestGrpcSendMessageHooks checks that the daemon stores the text that is sent
+// after the hooks and reports vetoed messages.
+func TestGrpcSendMessageHooks(t *testing.T) {
+	client, lnd, _, cleanUp := testDaemon(t)
+	defer cleanUp()
+
+	var readLog func() string
+	var cleanUpHooks func()
+	hooks, readLog, cleanUpHooks = testHooks(t, map[string]string{
+		"upper.star": `
+def before_send(msg):
+    if msg.text == "secret":
+        return False
+    return msg.text.upper()
+
+def on_delivered(msg):
+    print("delivered", msg.text)
+`,
+	})
+	defer func() {
+		hooks = nil
+		cleanUpHooks()
+	}()
+
+	ctx, cancel := authContext()
+	defer cancel()
+
+	_, err := client.SendMessage(ctx, &whatsatrpc.SendMessageRequest{
+		Peer: "bob",
+		Text: "secret",
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected failed precondition, got %v", err)
+	}
+	expectNoPayment(t, lnd)
+
+	msg, err := client.SendMessage(ctx, &whatsatrpc.SendMessageRequest{
+		Peer: "bob",
+		Text: "hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "HELLO" {
+		t.Fatalf("expected the text after the hooks, got %q", msg.Text)
+	}
+	if texts := sentTexts(t, lnd, 1); texts[0] != "HELLO" {
+		t.Fatalf("unexpected payment: %q", texts)
+	}
+
+	history, err := client.GetHistory(ctx, &whatsatrpc.GetHistoryRequest{
+		Peer: testPeerKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Messages) != 1 || history.Messages[0].Text != "HELLO" {
+		t.Fatalf("unexpected history: %v", history.Messages)
+	}
+
+	// Wait for the delivery hook, so that it doesn't run into the next
+	// test.
+	deadline := time.Now().Add(testTimeout)
+	for !strings.Contains(readLog(), "delivered HELLO") {
+		if time.Now().After(deadline) {
+			t.Fatal("delivery hook not called")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestGrpcHookReply checks that replies of the receive hooks are stored and
+// streamed like other sent messages.
+func TestGrpcHookReply(t *testing.T) {
+	client, lnd, store, cleanUp := testDaemon(t)
+	defer cleanUp()
+
+	var cleanUpHooks func()
+	hooks, _, cleanUpHooks = testHooks(t, map[string]string{
+		"auto.star": `
+def on_receive(msg):
+    return "away"
+`,
+	})
+	defer func() {
+		hooks = nil
+		cleanUpHooks()
+	}()
+
+	ctx, cancel := authContext()
+	defer cancel()
+
+	events, err := client.SubscribeMessages(
+		ctx, &whatsatrpc.SubscribeMessagesRequest{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForSubscriber(t, store)
+
+	sender := testPeer(t)
+	var timeBuffer [8]byte
+	byteOrder.PutUint64(timeBuffer[:], uint64(time.Now().UnixNano()))
+
+	lnd.invoices <- &lnrpc.Invoice{
+		State:       lnrpc.Invoice_SETTLED,
+		AmtPaidMsat: 1000,
+		Htlcs: []*lnrpc.InvoiceHTLC{{
+			State: lnrpc.InvoiceHTLCState_SETTLED,
+			CustomRecords: map[uint64][]byte{
+				tlvMsgRecord:    []byte("are you there?"),
+				tlvSigRecord:    []byte("sig"),
+				tlvSenderRecord: sender[:],
+				tlvTimeRecord:   timeBuffer[:],
+			},
+		}},
+	}
+
+	for _, expected := range []whatsatrpc.MessageEvent_EventType{
+		whatsatrpc.MessageEvent_RECEIVED, whatsatrpc.MessageEvent_SENT,
+	} {
+		event, err := events.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != expected {
+			t.Fatalf("expected %v, got %v", expected, event)
+		}
+		if expected == whatsatrpc.MessageEvent_SENT &&
+			(event.Message.Text != "away" ||
+				event.Message.Peer != testPeerKey) {
+
+			t.Fatalf("unexpected reply: %v", event.Message)
+		}
+	}
+
+	if texts := sentTexts(t, lnd, 1); texts[0] != "away" {
+		t.Fatalf("unexpected payment: %q", texts)
+	}
+}
+
+func TestHookRange(t *testing.T) {
+	h, readLog, cleanUp := testHooks(t, map[string]string{
+		"range.star": `
+loaded = range(3)
+
+def before_send(msg):
+    r = range(10, 0, -3)
+    print(type(r), len(r), r[1], list(r), list(r[1:]), 4 in r,
+          r == range(10, 0, -3), list(loaded))
+    return msg.text
+`,
+	})
+	defer cleanUp()
+
+	if _, err := h.beforeSend(testPeer(t), "hello", 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// The range behaves like the builtin one.
+	expected := `range 4 7 [10, 7, 4, 1] [7, 4, 1] True True [0, 1, 2]`
+	if !strings.Contains(readLog(), expected) {
+		t.Fatalf("%q missing in log:\n%v", expected, readLog())
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// ircMaxText is the maximum number of bytes of text that are sent in
+	// a single PRIVMSG. The protocol limits lines to 512 bytes including
+	// the command and the prefix that the server adds.
+	ircMaxText = 400
+
+	ircRegisterTimeout = 30 * time.Second
+)
+
+// ircMessage is a parsed line of the irc protocol.
+type ircMessage struct {
+	prefix  string
+	command string
+	params  []string
+}
+
+// parseIRCMessage parses a line of the form
+// [:prefix] command [params] [:trailing].
+func parseIRCMessage(line string) *ircMessage {
+	line = strings.TrimRight(line, "\r\n")
+	msg := &ircMessage{}
+
+	if strings.HasPrefix(line, ":") {
+		parts := strings.SplitN(line[1:], " ", 2)
+		msg.prefix = parts[0]
+		if len(parts) == 1 {
+			return msg
+		}
+		line = parts[1]
+	}
+
+	var trailing *string
+	if i := strings.Index(line, " :"); i >= 0 {
+		t := line[i+2:]
+		trailing = &t
+		line = line[:i]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		msg.command = strings.ToUpper(fields[0])
+		msg.params = fields[1:]
+	}
+	if trailing != nil {
+		msg.params = append(msg.params, *trailing)
+	}
+
+	return msg
+}
+
+// nick returns the nickname part of the message prefix.
+func (m *ircMessage) nick() string {
+	if i := strings.Index(m.prefix, "!"); i >= 0 {
+		return m.prefix[:i]
+	}
+
+	return m.prefix
+}
+
+// ircClient is a minimal irc client that supports what the bridge needs:
+// registering, joining a channel and exchanging private messages.
+type ircClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	nick   string
+
+	writeMtx sync.Mutex
+}
+
+// dialIRC connects to the server and registers with the nickname. If the
+// nickname is taken, underscores are appended until it is accepted.
+func dialIRC(addr string, useTLS bool, nick, password string) (*ircClient,
+	error) {
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if useTLS {
+		conn, err = tls.Dial("tcp", addr, &tls.Config{})
+	} else {
+		conn, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ircClient{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		nick:   nick,
+	}
+
+	if err := c.register(password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// register sends the registration commands and waits for the welcome reply.
+func (c *ircClient) register(password string) error {
+	deadline := time.Now().Add(ircRegisterTimeout)
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	if password != "" {
+		if err := c.send("PASS", password); err != nil {
+			return err
+		}
+	}
+	if err := c.send("NICK", c.nick); err != nil {
+		return err
+	}
+	err := c.send("USER", c.nick, "0", "*", "whatsat bridge")
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		switch msg.command {
+		// RPL_WELCOME
+		case "001":
+			return c.conn.SetDeadline(time.Time{})
+
+		// ERR_NICKNAMEINUSE
+		case "433":
+			c.nick += "_"
+			if err := c.send("NICK", c.nick); err != nil {
+				return err
+			}
+
+		case "PING":
+			if err := c.send("PONG", msg.params...); err != nil {
+				return err
+			}
+
+		case "ERROR":
+			return fmt.Errorf("irc server error: %v",
+				strings.Join(msg.params, " "))
+		}
+	}
+}
+
+// send writes a command. The last parameter may contain spaces, the others
+// may not.
+func (c *ircClient) send(command string, params ...string) error {
+	line := command
+	for i, p := range params {
+		trailing := i == len(params)-1 && (p == "" ||
+			strings.Contains(p, " ") || strings.HasPrefix(p, ":"))
+
+		if trailing {
+			line += " :" + p
+		} else {
+			line += " " + p
+		}
+	}
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+func (c *ircClient) read() (*ircMessage, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	return parseIRCMessage(line), nil
+}
+
+// join joins a channel.
+func (c *ircClient) join(channel string) error {
+	return c.send("JOIN", channel)
+}
+
+// privmsg sends the text to a channel or nickname. Lines are sent as separate
+// messages and long lines are split. Carriage returns and nul bytes also end
+// a line, because the server would otherwise read the rest of the text as a
+// new command.
+func (c *ircClient) privmsg(target, text string) error {
+	lines := strings.FieldsFunc(text, func(r rune) bool {
+		return r == '\r' || r == '\n' || r == 0
+	})
+	for _, line := range lines {
+		for len(line) > 0 {
+			n := len(line)
+			if n > ircMaxText {
+				// Don't split inside a utf-8 sequence. Invalid
+				// utf-8 may not have a rune start to split at.
+				n = ircMaxText
+				for n > 0 && !utf8.RuneStart(line[n]) {
+					n--
+				}
+				if n == 0 {
+					n = ircMaxText
+				}
+			}
+			chunk := line[:n]
+			line = line[n:]
+
+			if err := c.send("PRIVMSG", target, chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// run reads messages until the connection fails and passes them to the
+// handler. Pings are answered automatically.
+func (c *ircClient) run(handler func(*ircMessage)) error {
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		switch msg.command {
+		case "PING":
+			if err := c.send("PONG", msg.params...); err != nil {
+				return err
+			}
+
+		case "ERROR":
+			return fmt.Errorf("irc server error: %v",
+				strings.Join(msg.params, " "))
+
+		default:
+			handler(msg)
+		}
+	}
+}
+
+// close quits and closes the connection.
+func (c *ircClient) close() error {
+	_ = c.send("QUIT", "bye")
+	return c.conn.Close()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestParseIRCMessage(t *testing.T) {
+	tests := []struct {
+		line    string
+		prefix  string
+		command string
+		params  []string
+	}{
+		{"PING :irc.example.com\r\n", "", "PING",
+			[]string{"irc.example.com"}},
+		{":nick!user@host PRIVMSG #chan :hello world", "nick!user@host",
+			"PRIVMSG", []string{"#chan", "hello world"}},
+		{":server 001 whatsat :Welcome", "server", "001",
+			[]string{"whatsat", "Welcome"}},
+		{"privmsg bob :", "", "PRIVMSG", []string{"bob", ""}},
+	}
+
+	for _, test := range tests {
+		msg := parseIRCMessage(test.line)
+		if msg.prefix != test.prefix || msg.command != test.command ||
+			!reflect.DeepEqual(msg.params, test.params) {
+
+			t.Errorf("%q: unexpected message %+v", test.line, msg)
+		}
+	}
+}
+
+// privmsgLines sends the text through privmsg and returns the lines that were
+// written to the connection, without the line endings.
+func privmsgLines(t *testing.T, text string) []string {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	c := &ircClient{
+		conn: local,
+		nick: "whatsat",
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- c.privmsg("#chan", text)
+		local.Close()
+	}()
+
+	var lines []string
+	scanner := bufio.NewScanner(remote)
+	done := time.After(5 * time.Second)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.ContainsAny(line, "\r\x00") {
+			t.Fatalf("line break inside a line: %q", line)
+		}
+		lines = append(lines, line)
+
+		select {
+		case <-done:
+			t.Fatalf("privmsg doesn't finish, sent %v lines",
+				len(lines))
+		default:
+		}
+	}
+
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+
+	return lines
+}
+
+func TestPrivmsgLineBreaks(t *testing.T) {
+	lines := privmsgLines(
+		t, "hi\rQUIT :x\n\nthere\r\nPRIVMSG NickServ :y\x00JOIN #z",
+	)
+
+	expected := []string{
+		"PRIVMSG #chan hi",
+		"PRIVMSG #chan :QUIT :x",
+		"PRIVMSG #chan there",
+		"PRIVMSG #chan :PRIVMSG NickServ :y",
+		"PRIVMSG #chan :JOIN #z",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+}
+
+func TestPrivmsgLongLines(t *testing.T) {
+	// A multi-byte character straddles the split point.
+	text := strings.Repeat("a", ircMaxText-1) + "é" + "b"
+	lines := privmsgLines(t, text)
+
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", lines)
+	}
+	for _, line := range lines {
+		if !utf8.ValidString(line) {
+			t.Fatalf("line split inside a character: %q", line)
+		}
+	}
+	if !strings.HasSuffix(lines[1], " éb") {
+		t.Fatalf("unexpected second line: %q", lines[1])
+	}
+}
+
+func TestPrivmsgInvalidUTF8(t *testing.T) {
+	// Continuation bytes without a rune start can't be split at a
+	// character boundary.
+	text := strings.Repeat("\x80", 2*ircMaxText+10)
+	lines := privmsgLines(t, text)
+
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %v", len(lines))
+	}
+
+	var sent int
+	for _, line := range lines {
+		sent += len(line) - len("PRIVMSG #chan ")
+	}
+	if sent != len(text) {
+		t.Fatalf("expected %v bytes, got %v", len(text), sent)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// lndConnect holds the connection parameters of an lndconnect uri:
+//
+//	lndconnect://<host>:<port>?cert=<base64url DER cert>&macaroon=<base64url macaroon>
+//
+// Both the certificate and the macaroon are optional.
+type lndConnect struct {
+	host     string
+	cert     *x509.Certificate
+	macaroon []byte
+}
+
+// parseLndConnect decodes an lndconnect uri.
+func parseLndConnect(uri string) (*lndConnect, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "lndconnect" {
+		return nil, fmt.Errorf("not an lndconnect uri: %v", uri)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("lndconnect uri without host")
+	}
+
+	c := &lndConnect{
+		host: u.Host,
+	}
+
+	query := u.Query()
+	if cert := query.Get("cert"); cert != "" {
+		der, err := decodeBase64URL(cert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode lndconnect "+
+				"cert: %v", err)
+		}
+
+		c.cert, err = x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse lndconnect "+
+				"cert: %v", err)
+		}
+	}
+
+	if mac := query.Get("macaroon"); mac != "" {
+		c.macaroon, err = decodeBase64URL(mac)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode lndconnect "+
+				"macaroon: %v", err)
+		}
+	}
+
+	return c, nil
+}
+
+// decodeBase64URL decodes base64url data with or without padding.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -5,6 +5,9 @@
 package main
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -38,6 +41,9 @@ var (
 	defaultLndDir      = btcutil.AppDataDir("lnd", false)
 	defaultTLSCertPath = filepath.Join(defaultLndDir, defaultTLSCertFilename)
 
+	// defaultWhatsatDir is the directory where whatsat keeps its own data.
+	defaultWhatsatDir = btcutil.AppDataDir("whatsat", false)
+
 	// maxMsgRecvSize is the largest message our client will receive. We
 	// set this to 200MiB atm.
 	maxMsgRecvSize = grpc.MaxCallRecvMsgSize(1 * 1024 * 1024 * 200)
@@ -69,17 +75,45 @@ func getClient(ctx *cli.Context) (lnrpc.LightningClient, func()) {
 }
 
 func getClientConn(ctx *cli.Context, skipMacaroons bool) *grpc.ClientConn {
+	// An lndconnect uri provides the host, cert and macaroon at once. They
+	// can still be overridden individually.
+	var lndConn *lndConnect
+	if uri := ctx.GlobalString("lndconnect"); uri != "" {
+		var err error
+		lndConn, err = parseLndConnect(uri)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
 	// First, we'll parse the args from the command.
-	tlsCertPath, macPath, err := extractPathArgs(ctx)
+	tlsCertPath, macPath, err := extractPathArgs(ctx, lndConn)
 	if err != nil {
 		fatal(err)
 	}
 
-	// Load the specified TLS certificate and build transport credentials
-	// with it.
-	creds, err := credentials.NewClientTLSFromFile(tlsCertPath, "")
-	if err != nil {
-		fatal(err)
+	// Load the TLS certificate and build transport credentials with it.
+	// The certificate from the lndconnect uri is used unless a path is
+	// set explicitly.
+	var creds credentials.TransportCredentials
+	switch {
+	case lndConn != nil && !ctx.GlobalIsSet("tlscertpath") &&
+		!ctx.GlobalIsSet("lnddir"):
+
+		// Without a certificate in the uri, lnd's certificate is
+		// expected to be signed by a trusted CA.
+		var certPool *x509.CertPool
+		if lndConn.cert != nil {
+			certPool = x509.NewCertPool()
+			certPool.AddCert(lndConn.cert)
+		}
+		creds = credentials.NewClientTLSFromCert(certPool, "")
+
+	default:
+		creds, err = credentials.NewClientTLSFromFile(tlsCertPath, "")
+		if err != nil {
+			fatal(err)
+		}
 	}
 
 	// Create a dial options array.
@@ -90,11 +124,29 @@ func getClientConn(ctx *cli.Context, skipMacaroons bool) *grpc.ClientConn {
 	// Only process macaroon credentials if --no-macaroons isn't set and
 	// if we're not skipping macaroon processing.
 	if !ctx.GlobalBool("no-macaroons") && !skipMacaroons {
-		// Load the specified macaroon file.
-		macBytes, err := ioutil.ReadFile(macPath)
-		if err != nil {
-			fatal(fmt.Errorf("unable to read macaroon path (check "+
-				"the network setting!): %v", err))
+		var macBytes []byte
+		switch {
+		case ctx.GlobalString("macaroon-hex") != "":
+			macBytes, err = hex.DecodeString(
+				ctx.GlobalString("macaroon-hex"),
+			)
+			if err != nil {
+				fatal(fmt.Errorf("unable to decode macaroon "+
+					"hex: %v", err))
+			}
+
+		case lndConn != nil && lndConn.macaroon != nil &&
+			!ctx.GlobalIsSet("macaroonpath"):
+
+			macBytes = lndConn.macaroon
+
+		default:
+			// Load the specified macaroon file.
+			macBytes, err = ioutil.ReadFile(macPath)
+			if err != nil {
+				fatal(fmt.Errorf("unable to read macaroon path "+
+					"(check the network setting!): %v", err))
+			}
 		}
 
 		mac := &macaroon.Macaroon{}
@@ -116,7 +168,15 @@ func getClientConn(ctx *cli.Context, skipMacaroons bool) *grpc.ClientConn {
 		}
 
 		// Now we append the macaroon credentials to the dial options.
-		cred := macaroons.NewMacaroonCredential(constrainedMac)
+		// The anti-replay timeout is added for every call, because
+		// commands like chat and daemon keep the connection open for
+		// longer than the timeout.
+		cred := timeoutMacaroonCredential{
+			MacaroonCredential: macaroons.NewMacaroonCredential(
+				constrainedMac,
+			),
+			timeout: ctx.GlobalInt64("macaroontimeout"),
+		}
 		opts = append(opts, grpc.WithPerRPCCredentials(cred))
 	}
 
@@ -126,7 +186,7 @@ func getClientConn(ctx *cli.Context, skipMacaroons bool) *grpc.ClientConn {
 	opts = append(opts, grpc.WithDialer(genericDialer))
 	opts = append(opts, grpc.WithDefaultCallOptions(maxMsgRecvSize))
 
-	conn, err := grpc.Dial(ctx.GlobalString("rpcserver"), opts...)
+	conn, err := grpc.Dial(nodeAddress(ctx, lndConn), opts...)
 	if err != nil {
 		fatal(fmt.Errorf("unable to connect to RPC server: %v", err))
 	}
@@ -134,24 +194,57 @@ func getClientConn(ctx *cli.Context, skipMacaroons bool) *grpc.ClientConn {
 	return conn
 }
 
+// nodeAddress returns the address of the lnd node to connect to. The host of
+// the lndconnect uri is used unless the rpc server is set explicitly.
+func nodeAddress(ctx *cli.Context, lndConn *lndConnect) string {
+	if lndConn != nil && !ctx.GlobalIsSet("rpcserver") {
+		return lndConn.host
+	}
+
+	return ctx.GlobalString("rpcserver")
+}
+
+// timeoutMacaroonCredential passes the macaroon with a timeout caveat that is
+// added anew for every call.
+type timeoutMacaroonCredential struct {
+	macaroons.MacaroonCredential
+
+	// timeout is the validity time in seconds. Zero disables the
+	// timeout.
+	timeout int64
+}
+
+// GetRequestMetadata implements the PerRPCCredentials interface.
+func (c timeoutMacaroonCredential) GetRequestMetadata(ctx context.Context,
+	uri ...string) (map[string]string, error) {
+
+	if c.timeout <= 0 {
+		return c.MacaroonCredential.GetRequestMetadata(ctx, uri...)
+	}
+
+	mac, err := macaroons.AddConstraints(
+		c.Macaroon, macaroons.TimeoutConstraint(c.timeout),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return macaroons.NewMacaroonCredential(mac).GetRequestMetadata(
+		ctx, uri...,
+	)
+}
+
 // extractPathArgs parses the TLS certificate and macaroon paths from the
 // command.
-func extractPathArgs(ctx *cli.Context) (string, string, error) {
+func extractPathArgs(ctx *cli.Context, lndConn *lndConnect) (string, string,
+	error) {
+
 	// We'll start off by parsing the active chain and network. These are
 	// needed to determine the correct path to the macaroon when not
 	// specified.
-	chain := strings.ToLower(ctx.GlobalString("chain"))
-	switch chain {
-	case "bitcoin", "litecoin":
-	default:
-		return "", "", fmt.Errorf("unknown chain: %v", chain)
-	}
-
-	network := strings.ToLower(ctx.GlobalString("network"))
-	switch network {
-	case "mainnet", "testnet", "regtest", "simnet":
-	default:
-		return "", "", fmt.Errorf("unknown network: %v", network)
+	chain, network, err := getChainAndNetwork(ctx)
+	if err != nil {
+		return "", "", err
 	}
 
 	// We'll now fetch the lnddir so we can make a decision  on how to
@@ -173,6 +266,20 @@ func extractPathArgs(ctx *cli.Context) (string, string, error) {
 			lndDir, defaultDataDir, defaultChainSubDir, chain,
 			network, defaultMacaroonFilename,
 		)
+
+		// A macaroon baked for whatsat on the same node is preferred
+		// over the admin macaroon, except for baking a new one.
+		whatsatMacPath, err := whatsatMacaroonPath(ctx, lndConn)
+		if err != nil {
+			return "", "", err
+		}
+		if _, err := os.Stat(whatsatMacPath); err == nil &&
+			ctx.Command.Name != "bakemacaroon" {
+
+			fmt.Fprintf(os.Stderr, "[whatsat] using macaroon %v\n",
+				whatsatMacPath)
+			macPath = whatsatMacPath
+		}
 	}
 
 	tlsCertPath := cleanAndExpandPath(ctx.GlobalString("tlscertpath"))
@@ -189,6 +296,31 @@ func extractPathArgs(ctx *cli.Context) (string, string, error) {
 	return tlsCertPath, macPath, nil
 }
 
+// getChainAndNetwork returns the validated chain and network that lnd is
+// running on.
+func getChainAndNetwork(ctx *cli.Context) (string, string, error) {
+	chain := strings.ToLower(ctx.GlobalString("chain"))
+	switch chain {
+	case "bitcoin", "litecoin":
+	default:
+		return "", "", fmt.Errorf("unknown chain: %v", chain)
+	}
+
+	network := strings.ToLower(ctx.GlobalString("network"))
+	switch network {
+	case "mainnet", "testnet", "regtest", "simnet":
+	default:
+		return "", "", fmt.Errorf("unknown network: %v", network)
+	}
+
+	return chain, network, nil
+}
+
+// getDataDir returns the whatsat data directory.
+func getDataDir(ctx *cli.Context) string {
+	return cleanAndExpandPath(ctx.GlobalString("datadir"))
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "whatsat"
@@ -205,6 +337,16 @@ func main() {
 			Value: defaultLndDir,
 			Usage: "path to lnd's base directory",
 		},
+		cli.StringFlag{
+			Name:  "datadir",
+			Value: defaultWhatsatDir,
+			Usage: "path to whatsat's data directory",
+		},
+		cli.StringFlag{
+			Name: "profile",
+			Usage: "name of the profile in whatsat.conf in the " +
+				"data directory to take settings from",
+		},
 		cli.StringFlag{
 			Name:  "tlscertpath",
 			Value: defaultTLSCertPath,
@@ -229,6 +371,17 @@ func main() {
 			Name:  "macaroonpath",
 			Usage: "path to macaroon file",
 		},
+		cli.StringFlag{
+			Name:   "macaroon-hex",
+			Usage:  "hex encoded macaroon, instead of macaroonpath",
+			EnvVar: "WHATSAT_MACAROON_HEX",
+		},
+		cli.StringFlag{
+			Name: "lndconnect",
+			Usage: "lndconnect uri with the host, TLS certificate " +
+				"and macaroon to connect with",
+			EnvVar: "WHATSAT_LNDCONNECT",
+		},
 		cli.Int64Flag{
 			Name:  "macaroontimeout",
 			Value: 60,
@@ -239,8 +392,11 @@ func main() {
 			Usage: "if set, lock macaroon to specific IP address",
 		},
 	}
+	app.Before = applyConfig
 	app.Commands = []cli.Command{
-		chatCommand, chatPeersCommand,
+		chatCommand, chatPeersCommand, addressCommand, simulateCommand,
+		chatPolicyCommand, bakeMacaroonCommand, doctorCommand,
+		daemonCommand, botCommand, notifyCommand, bridgeCommand,
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+const matrixTimeout = 30 * time.Second
+
+// matrixClient is a minimal client for the matrix client-server api, using
+// the token of an application service.
+type matrixClient struct {
+	homeserver string
+	token      string
+	http       *http.Client
+
+	// txnCounter makes the transaction ids of sent events unique.
+	txnCounter uint64
+}
+
+func newMatrixClient(homeserver, token string) *matrixClient {
+	return &matrixClient{
+		homeserver: homeserver,
+		token:      token,
+		http: &http.Client{
+			Timeout: matrixTimeout,
+		},
+	}
+}
+
+// matrixError is the error response of the matrix api.
+type matrixError struct {
+	ErrCode string `json:"errcode"`
+	Err     string `json:"error"`
+}
+
+func (e *matrixError) Error() string {
+	return fmt.Sprintf("%v: %v", e.ErrCode, e.Err)
+}
+
+// do calls the api and decodes the json response into resp, if it isn't nil.
+func (c *matrixClient) do(method, path string, req, resp interface{}) error {
+	var body bytes.Buffer
+	if req != nil {
+		if err := json.NewEncoder(&body).Encode(req); err != nil {
+			return err
+		}
+	}
+
+	httpReq, err := http.NewRequest(method, c.homeserver+path, &body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		matrixErr := &matrixError{}
+		err := json.NewDecoder(httpResp.Body).Decode(matrixErr)
+		if err != nil || matrixErr.ErrCode == "" {
+			return fmt.Errorf("%v %v: %v", method, path,
+				httpResp.Status)
+		}
+		return matrixErr
+	}
+
+	if resp == nil {
+		return nil
+	}
+
+	return json.NewDecoder(httpResp.Body).Decode(resp)
+}
+
+// createRoom creates a private room with the name and invites the users. It
+// returns the room id.
+func (c *matrixClient) createRoom(name, topic string,
+	invite []string) (string, error) {
+
+	req := struct {
+		Name     string   `json:"name"`
+		Topic    string   `json:"topic"`
+		Invite   []string `json:"invite"`
+		Preset   string   `json:"preset"`
+		IsDirect bool     `json:"is_direct"`
+	}{
+		Name:     name,
+		Topic:    topic,
+		Invite:   invite,
+		Preset:   "private_chat",
+		IsDirect: true,
+	}
+
+	var resp struct {
+		RoomID string `json:"room_id"`
+	}
+
+	err := c.do(http.MethodPost, "/_matrix/client/r0/createRoom", &req,
+		&resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.RoomID, nil
+}
+
+// sendMessage sends a message event with the message type, for example
+// m.text or m.notice, to the room.
+func (c *matrixClient) sendMessage(roomID, msgType, text string) error {
+	txnID := fmt.Sprintf("whatsat%v.%v", time.Now().UnixNano(),
+		atomic.AddUint64(&c.txnCounter, 1))
+
+	path := fmt.Sprintf("/_matrix/client/r0/rooms/%v/send/"+
+		"m.room.message/%v", url.PathEscape(roomID), txnID)
+
+	req := struct {
+		MsgType string `json:"msgtype"`
+		Body    string `json:"body"`
+	}{
+		MsgType: msgType,
+		Body:    text,
+	}
+
+	return c.do(http.MethodPut, path, &req, nil)
+}
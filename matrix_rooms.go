@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+const matrixRoomsFilename = "matrix_rooms.json"
+
+// matrixRooms maps whatsat peers to the matrix rooms that mirror their
+// conversations. The mapping is stored as json in the data directory, so that
+// the same rooms are used after a restart.
+type matrixRooms struct {
+	path string
+
+	mtx    sync.RWMutex
+	byPeer map[route.Vertex]string
+}
+
+// loadMatrixRooms reads the room mapping from the file. A missing file results
+// in an empty mapping.
+func loadMatrixRooms(path string) (*matrixRooms, error) {
+	r := &matrixRooms{
+		path:   path,
+		byPeer: make(map[route.Vertex]string),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rooms map[string]string
+	if err := json.Unmarshal(b, &rooms); err != nil {
+		return nil, fmt.Errorf("cannot parse %v: %v", path, err)
+	}
+
+	for peerStr, roomID := range rooms {
+		peer, err := route.NewVertexFromStr(peerStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer in %v: %v", path,
+				err)
+		}
+		r.byPeer[peer] = roomID
+	}
+
+	return r, nil
+}
+
+// room returns the room of the peer.
+func (r *matrixRooms) room(peer route.Vertex) (string, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	roomID, ok := r.byPeer[peer]
+	return roomID, ok
+}
+
+// peer returns the peer that the room belongs to.
+func (r *matrixRooms) peer(roomID string) (route.Vertex, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for peer, id := range r.byPeer {
+		if id == roomID {
+			return peer, true
+		}
+	}
+
+	return route.Vertex{}, false
+}
+
+// add stores the room of the peer.
+func (r *matrixRooms) add(peer route.Vertex, roomID string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.byPeer[peer] = roomID
+
+	rooms := make(map[string]string, len(r.byPeer))
+	for p, id := range r.byPeer {
+		rooms[p.String()] = id
+	}
+
+	b, err := json.MarshalIndent(rooms, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, b, 0600)
+}
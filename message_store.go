@@ -0,0 +1,281 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+// storedMessage is a message in the conversation history of the daemon.
+type storedMessage struct {
+	ID        uint64    `json:"id"`
+	Peer      string    `json:"peer"`
+	Alias     string    `json:"alias"`
+	Outgoing  bool      `json:"outgoing"`
+	Text      string    `json:"text"`
+	Timestamp time.Time `json:"timestamp"`
+	State     string    `json:"state"`
+	FeeMsat   int64     `json:"fee_msat"`
+	AmtMsat   int64     `json:"amt_msat"`
+}
+
+// conversation summarizes the messages exchanged with a single peer.
+type conversation struct {
+	Peer        string         `json:"peer"`
+	Alias       string         `json:"alias"`
+	Messages    int            `json:"messages"`
+	BalanceMsat int64          `json:"balance_msat"`
+	LastMessage *storedMessage `json:"last_message"`
+}
+
+const (
+	// eventReceived is published for a verified incoming message.
+	eventReceived = "received"
+
+	// eventSent is published when sending a message starts.
+	eventSent = "sent"
+
+	// eventDelivery is published when the delivery state of a sent
+	// message changes.
+	eventDelivery = "delivery"
+)
+
+const (
+	// subscriberBuffer is the number of events that are queued for a
+	// subscriber before it is disconnected.
+	subscriberBuffer = 100
+
+	// maxPeerHistory is the number of messages per peer that are kept.
+	// Older messages are dropped, so that the history doesn't grow for
+	// the whole life of the daemon.
+	maxPeerHistory = 1000
+)
+
+// messageEvent notifies subscribers of a new message or a delivery update.
+type messageEvent struct {
+	Type    string         `json:"type"`
+	Message *storedMessage `json:"message"`
+}
+
+// peerHistory holds the most recent messages exchanged with a peer.
+type peerHistory struct {
+	// messages are the kept messages, oldest first.
+	messages []*storedMessage
+
+	// total is the number of messages exchanged, including the ones
+	// that were dropped.
+	total int
+}
+
+// messageStore keeps the in-memory conversation history of the daemon and
+// publishes changes to subscribers.
+type messageStore struct {
+	engine   *chatEngine
+	contacts *contactBook
+
+	mtx         sync.Mutex
+	lastID      uint64
+	peers       map[string]*peerHistory
+	subscribers map[chan *messageEvent]struct{}
+}
+
+func newMessageStore(engine *chatEngine,
+	contacts *contactBook) *messageStore {
+
+	return &messageStore{
+		engine:      engine,
+		contacts:    contacts,
+		peers:       make(map[string]*peerHistory),
+		subscribers: make(map[chan *messageEvent]struct{}),
+	}
+}
+
+// add stores a message, assigns its id and publishes it. The oldest message
+// of the peer is dropped when it has more than maxPeerHistory messages. The
+// caller must hold the mutex.
+func (s *messageStore) add(eventType string, msg *storedMessage) {
+	s.lastID++
+	msg.ID = s.lastID
+
+	h, ok := s.peers[msg.Peer]
+	if !ok {
+		h = &peerHistory{}
+		s.peers[msg.Peer] = h
+	}
+	h.messages = append(h.messages, msg)
+	h.total++
+
+	if len(h.messages) > maxPeerHistory {
+		h.messages[0] = nil
+		h.messages = h.messages[1:]
+	}
+
+	s.publish(eventType, msg)
+}
+
+// publish sends a copy of the message to all subscribers. Subscribers that
+// can't keep up are disconnected by closing their channel, so that they know
+// that they missed events. The caller must hold the mutex.
+func (s *messageStore) publish(eventType string, msg *storedMessage) {
+	msgCopy := *msg
+	event := &messageEvent{
+		Type:    eventType,
+		Message: &msgCopy,
+	}
+
+	for sub := range s.subscribers {
+		select {
+		case sub <- event:
+		default:
+			delete(s.subscribers, sub)
+			close(sub)
+		}
+	}
+}
+
+// send sends a message through the engine and tracks its delivery. The text is
+// stored as it is after the before_send hooks.
+func (s *messageStore) send(dest route.Vertex,
+	text string) (*storedMessage, error) {
+
+	text, err := s.engine.beforeSend(dest, text)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mtx.Lock()
+	msg := &storedMessage{
+		Peer:      dest.String(),
+		Alias:     s.contacts.alias(dest),
+		Outgoing:  true,
+		Text:      text,
+		Timestamp: time.Now(),
+		State:     statePending.String(),
+		AmtMsat:   s.engine.payAmt(dest),
+	}
+	s.add(eventSent, msg)
+	msgCopy := *msg
+	s.mtx.Unlock()
+
+	err = s.engine.deliver(dest, text, func(u *deliveryUpdate) {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		if msg.State == u.state.String() {
+			return
+		}
+		msg.State = u.state.String()
+		msg.FeeMsat = u.fee
+
+		s.publish(eventDelivery, msg)
+	})
+	if err != nil {
+		s.mtx.Lock()
+		msg.State = stateFailed.String()
+		s.publish(eventDelivery, msg)
+		s.mtx.Unlock()
+
+		return nil, err
+	}
+
+	return &msgCopy, nil
+}
+
+// sendReply stores and sends a reply of a hook. It can be used as the reply
+// function for the receive loop of the engine.
+func (s *messageStore) sendReply(dest route.Vertex, text string) error {
+	_, err := s.send(dest, text)
+	return err
+}
+
+// addReceived stores an incoming message. It can be used as the handler for
+// the receive loop of the engine.
+func (s *messageStore) addReceived(msg *receivedMessage) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.add(eventReceived, &storedMessage{
+		Peer:      msg.sender.String(),
+		Alias:     s.contacts.alias(msg.sender),
+		Text:      msg.text,
+		Timestamp: msg.timestamp,
+		State:     stateDelivered.String(),
+		AmtMsat:   msg.amtMsat,
+	})
+}
+
+// history returns the kept messages exchanged with the peer, or those of all
+// peers if the peer is nil, oldest first.
+func (s *messageStore) history(peer *route.Vertex) []*storedMessage {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	history := make([]*storedMessage, 0)
+	for p, h := range s.peers {
+		if peer != nil && p != peer.String() {
+			continue
+		}
+
+		for _, msg := range h.messages {
+			msgCopy := *msg
+			history = append(history, &msgCopy)
+		}
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].ID < history[j].ID
+	})
+
+	return history
+}
+
+// conversations returns a summary per peer, most recently active first.
+func (s *messageStore) conversations() []*conversation {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	list := make([]*conversation, 0, len(s.peers))
+	for p, h := range s.peers {
+		last := *h.messages[len(h.messages)-1]
+		c := &conversation{
+			Peer:        p,
+			Alias:       last.Alias,
+			Messages:    h.total,
+			LastMessage: &last,
+		}
+
+		peer, err := route.NewVertexFromStr(p)
+		if err == nil {
+			c.BalanceMsat = s.engine.balance(peer)
+		}
+		list = append(list, c)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastMessage.ID > list[j].LastMessage.ID
+	})
+
+	return list
+}
+
+// subscribe returns a channel that receives all future events and a function
+// to cancel the subscription. The channel is closed when the subscriber falls
+// behind by more than subscriberBuffer events.
+func (s *messageStore) subscribe() (<-chan *messageEvent, func()) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sub := make(chan *messageEvent, subscriberBuffer)
+	s.subscribers[sub] = struct{}{}
+
+	cancel := func() {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		delete(s.subscribers, sub)
+	}
+
+	return sub, cancel
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+func TestMessageStoreHistoryLimit(t *testing.T) {
+	s := newMessageStore(&chatEngine{
+		runningBalance: make(map[route.Vertex]int64),
+	}, nil)
+
+	peer := testPeer(t)
+	other := testPeerKey[:len(testPeerKey)-1] + "c"
+
+	s.mtx.Lock()
+	for i := 0; i < maxPeerHistory+10; i++ {
+		s.add(eventReceived, &storedMessage{
+			Peer: peer.String(),
+			Text: fmt.Sprint(i),
+		})
+		if i%100 == 0 {
+			s.add(eventReceived, &storedMessage{Peer: other})
+		}
+	}
+	s.mtx.Unlock()
+
+	history := s.history(&peer)
+	if len(history) != maxPeerHistory {
+		t.Fatalf("expected %v messages, got %v", maxPeerHistory,
+			len(history))
+	}
+	if history[0].Text != "10" ||
+		history[len(history)-1].Text != fmt.Sprint(maxPeerHistory+9) {
+
+		t.Fatalf("unexpected messages kept: %v ... %v",
+			history[0].Text, history[len(history)-1].Text)
+	}
+
+	// The history of all peers is ordered by id.
+	all := s.history(nil)
+	if len(all) != maxPeerHistory+11 {
+		t.Fatalf("expected %v messages, got %v", maxPeerHistory+11,
+			len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].ID <= all[i-1].ID {
+			t.Fatalf("history out of order at %v", i)
+		}
+	}
+
+	conversations := s.conversations()
+	if len(conversations) != 2 {
+		t.Fatalf("expected 2 conversations, got %v",
+			len(conversations))
+	}
+	c := conversations[0]
+	if c.Peer != peer.String() || c.Messages != maxPeerHistory+10 ||
+		c.LastMessage.ID != all[len(all)-1].ID {
+
+		t.Fatalf("unexpected conversation: %+v", c)
+	}
+}
+
+func TestListenDaemonSocket(t *testing.T) {
+	dir, cleanUp := tempDir(t)
+	defer cleanUp()
+
+	// A regular file at the socket path is never removed.
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenDaemon("unix://" + path); err == nil {
+		t.Fatal("expected error for a regular file")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file removed: %v", err)
+	}
+
+	// A socket left behind by a previous run is replaced.
+	path = filepath.Join(dir, "sock")
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listenDaemon("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
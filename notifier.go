@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+// maxHeldNotifications is the number of notifications that are kept during
+// quiet hours. Older ones are dropped.
+const maxHeldNotifications = 20
+
+// quietHours is a daily time range in local time during which notifications
+// are held back.
+type quietHours struct {
+	// start and end are minutes since midnight. The range wraps around
+	// midnight if end is before start.
+	start, end int
+}
+
+// parseQuietHours parses a range of the form HH:MM-HH:MM.
+func parseQuietHours(s string) (*quietHours, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid quiet hours: %v", s)
+	}
+
+	start, err := parseTimeOfDay(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeOfDay(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &quietHours{
+		start: start,
+		end:   end,
+	}, nil
+}
+
+// parseTimeOfDay parses HH:MM into minutes since midnight.
+func parseTimeOfDay(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time of day: %v", s)
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 23 {
+		return 0, fmt.Errorf("invalid time of day: %v", s)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("invalid time of day: %v", s)
+	}
+
+	return hours*60 + minutes, nil
+}
+
+// contains returns whether the time falls within the quiet hours.
+func (q *quietHours) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if q.start <= q.end {
+		return m >= q.start && m < q.end
+	}
+
+	return m >= q.start || m < q.end
+}
+
+// notifier sends notifications to the node operators as chat messages.
+// Repeated notifications are suppressed and notifications during quiet hours
+// are held back and sent together when the quiet hours end.
+type notifier struct {
+	engine    *chatEngine
+	operators []route.Vertex
+
+	// dedupInterval is the time during which a notification with the
+	// same key isn't sent again.
+	dedupInterval time.Duration
+
+	// quiet holds the quiet hours. It is nil if there are none.
+	quiet *quietHours
+
+	mtx      sync.Mutex
+	lastSent map[string]time.Time
+	held     []string
+	dropped  int
+}
+
+func newNotifier(engine *chatEngine, operators []route.Vertex,
+	dedupInterval time.Duration, quiet *quietHours) *notifier {
+
+	return &notifier{
+		engine:        engine,
+		operators:     operators,
+		dedupInterval: dedupInterval,
+		quiet:         quiet,
+		lastSent:      make(map[string]time.Time),
+	}
+}
+
+// notify sends the text to the operators, unless a notification with the same
+// key was sent within the dedup interval. An empty key disables deduplication.
+func (n *notifier) notify(key, text string) {
+	if n.record(key, text, time.Now()) {
+		n.send(text)
+	}
+}
+
+// record registers the notification and returns whether it needs to be sent
+// now. Notifications that are suppressed or held back return false.
+func (n *notifier) record(key, text string, now time.Time) bool {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if key != "" {
+		if last, ok := n.lastSent[key]; ok &&
+			now.Sub(last) < n.dedupInterval {
+
+			return false
+		}
+
+		// Forget keys that can't suppress anything anymore.
+		for k, last := range n.lastSent {
+			if now.Sub(last) >= n.dedupInterval {
+				delete(n.lastSent, k)
+			}
+		}
+		n.lastSent[key] = now
+	}
+
+	fmt.Printf("%v %v\n", now.Format("15:04:05"), text)
+
+	if n.quiet != nil && n.quiet.contains(now) {
+		n.held = append(n.held, text)
+		if len(n.held) > maxHeldNotifications {
+			n.held = n.held[1:]
+			n.dropped++
+		}
+		return false
+	}
+
+	return true
+}
+
+// flush sends the notifications that were held back, if the quiet hours are
+// over. It needs to be called periodically.
+func (n *notifier) flush() {
+	if text := n.takeHeld(time.Now()); text != "" {
+		n.send(text)
+	}
+}
+
+// takeHeld returns the notifications that were held back as a single text and
+// clears them. It returns an empty string during the quiet hours.
+func (n *notifier) takeHeld(now time.Time) string {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if len(n.held) == 0 || (n.quiet != nil && n.quiet.contains(now)) {
+		return ""
+	}
+
+	text := strings.Join(n.held, "\n")
+	if n.dropped > 0 {
+		text = fmt.Sprintf("%v\n(%v older notifications dropped)",
+			text, n.dropped)
+	}
+
+	n.held = nil
+	n.dropped = 0
+
+	return text
+}
+
+// send delivers the text to all operators. It is called without holding the
+// mutex, because sending involves hooks and lnd calls that can take a while.
+func (n *notifier) send(text string) {
+	for _, operator := range n.operators {
+		operator := operator
+
+		err := n.engine.send(operator, text, func(u *deliveryUpdate) {
+			if u.state == stateFailed {
+				fmt.Printf("Notification to %v failed\n",
+					aliasOrKey(operator))
+			}
+		})
+		if err != nil {
+			fmt.Printf("Cannot notify %v: %v\n",
+				aliasOrKey(operator), err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifierHeld(t *testing.T) {
+	quiet := &quietHours{start: 0, end: 24 * 60}
+	n := newNotifier(nil, nil, time.Hour, quiet)
+
+	for i := 0; i < maxHeldNotifications+2; i++ {
+		n.notify("", fmt.Sprint(i))
+	}
+
+	// Repeated keys are suppressed.
+	n.notify("key", "first")
+	n.notify("key", "second")
+
+	if text := n.takeHeld(time.Now()); text != "" {
+		t.Fatalf("notifications released during quiet hours: %v",
+			text)
+	}
+
+	n.quiet = nil
+	text := n.takeHeld(time.Now())
+	lines := strings.Split(text, "\n")
+	if len(lines) != maxHeldNotifications+1 || lines[0] != "3" ||
+		lines[len(lines)-2] != "first" ||
+		lines[len(lines)-1] != "(3 older notifications dropped)" {
+
+		t.Fatalf("unexpected held notifications: %v", text)
+	}
+
+	if text := n.takeHeld(time.Now()); text != "" {
+		t.Fatalf("notifications released twice: %v", text)
+	}
+}
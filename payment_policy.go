@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lightningnetwork/lnd/routing/route"
+	"github.com/urfave/cli"
+)
+
+// paymentPolicyFlags are the flags of the commands that send messages to
+// restrict message routes.
+var paymentPolicyFlags = []cli.Flag{
+	cli.Uint64Flag{
+		Name:  "outgoing_chan_id",
+		Usage: "send all messages out over this channel",
+	},
+	cli.StringFlag{
+		Name: "last_hop",
+		Usage: "pubkey or alias of the node that messages must " +
+			"enter the destination through",
+	},
+	cli.Uint64Flag{
+		Name:  "cltv_limit",
+		Usage: "maximum total timelock of message routes",
+	},
+	cli.StringSliceFlag{
+		Name: "contact_policy",
+		Usage: "route restrictions for a single contact in the " +
+			"form <pubkey_or_alias>:outgoing_chan_id=<id>," +
+			"last_hop=<pubkey_or_alias>,cltv_limit=<n>; " +
+			"can be specified multiple times",
+	},
+}
+
+// paymentPolicy restricts the routes that are used to deliver chat messages.
+// This allows keeping chat traffic on a dedicated channel. Zero values mean
+// that lnd is free to choose.
+//
+// NOTE: The lnd version that whatsat is built against doesn't support
+// multi-path payments or a hop limit in SendPayment, so those can't be
+// restricted.
+type paymentPolicy struct {
+	// outgoingChanID pins the first hop of the route to this channel.
+	outgoingChanID uint64
+
+	// lastHop requires the route to enter the destination through this
+	// node.
+	lastHop *route.Vertex
+
+	// cltvLimit is the maximum total timelock of the route.
+	cltvLimit int32
+}
+
+var (
+	// defaultPolicy is applied to all destinations that don't have a
+	// contact policy.
+	defaultPolicy paymentPolicy
+
+	// contactPolicies holds the payment policies for specific contacts.
+	contactPolicies = make(map[route.Vertex]*paymentPolicy)
+)
+
+// getPolicy returns the payment policy to use for a destination.
+func getPolicy(dest route.Vertex) *paymentPolicy {
+	if p, ok := contactPolicies[dest]; ok {
+		return p
+	}
+
+	return &defaultPolicy
+}
+
+// apply sets the route restrictions of the policy on a payment request.
+func (p *paymentPolicy) apply(req *routerrpc.SendPaymentRequest) {
+	req.OutgoingChanId = p.outgoingChanID
+	req.CltvLimit = p.cltvLimit
+	if p.lastHop != nil {
+		req.LastHopPubkey = p.lastHop[:]
+	}
+}
+
+// applyQuery sets the route restrictions of the policy that QueryRoutes
+// supports on a route query.
+func (p *paymentPolicy) applyQuery(req *lnrpc.QueryRoutesRequest) {
+	req.CltvLimit = uint32(p.cltvLimit)
+}
+
+// parsePolicyFields parses a comma separated list of key=value policy fields
+// into the policy.
+func parsePolicyFields(p *paymentPolicy, fields string) error {
+	for _, field := range strings.Split(fields, ",") {
+		if field == "" {
+			continue
+		}
+
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid policy field: %v", field)
+		}
+
+		var err error
+		switch kv[0] {
+		case "outgoing_chan_id":
+			p.outgoingChanID, err = strconv.ParseUint(kv[1], 10, 64)
+
+		case "last_hop":
+			var lastHop route.Vertex
+			lastHop, err = parseNode(kv[1])
+			p.lastHop = &lastHop
+
+		case "cltv_limit":
+			var limit uint64
+			limit, err = strconv.ParseUint(kv[1], 10, 31)
+			p.cltvLimit = int32(limit)
+
+		default:
+			return fmt.Errorf("unknown policy field: %v", kv[0])
+		}
+		if err != nil {
+			return fmt.Errorf("invalid policy field %v: %v",
+				field, err)
+		}
+	}
+
+	return nil
+}
+
+// parseContactPolicy parses a contact policy of the form
+// <pubkey_or_alias>:<field>=<value>,... and stores it. Fields that aren't
+// set are taken from the default policy.
+func parseContactPolicy(s string) error {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid contact policy: %v", s)
+	}
+
+	contact, err := parseNode(parts[0])
+	if err != nil {
+		return err
+	}
+
+	p := defaultPolicy
+	if err := parsePolicyFields(&p, parts[1]); err != nil {
+		return err
+	}
+
+	contactPolicies[contact] = &p
+
+	return nil
+}
+
+// parseNode resolves a pubkey or alias to a node key.
+func parseNode(s string) (route.Vertex, error) {
+	if key, ok := aliasToKey[s]; ok {
+		return key, nil
+	}
+
+	return route.NewVertexFromStr(s)
+}
+
+// initPolicies sets up the default and per contact payment policies from the
+// command line flags. The alias maps need to be initialized first.
+func initPolicies(ctx *cli.Context) error {
+	defaultPolicy.outgoingChanID = ctx.Uint64("outgoing_chan_id")
+
+	cltvLimit := ctx.Uint64("cltv_limit")
+	if cltvLimit > math.MaxInt32 {
+		return fmt.Errorf("cltv_limit %v out of range", cltvLimit)
+	}
+	defaultPolicy.cltvLimit = int32(cltvLimit)
+
+	if ctx.IsSet("last_hop") {
+		lastHop, err := parseNode(ctx.String("last_hop"))
+		if err != nil {
+			return err
+		}
+		defaultPolicy.lastHop = &lastHop
+	}
+
+	for _, p := range ctx.StringSlice("contact_policy") {
+		if err := parseContactPolicy(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
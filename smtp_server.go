@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	// smtpMaxSize is the maximum size of a message that is accepted.
+	smtpMaxSize = 1024 * 1024
+
+	smtpTimeout = 5 * time.Minute
+)
+
+// smtpEnvelope is a mail that was received by the smtp server.
+type smtpEnvelope struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// smtpServer is a minimal smtp server that accepts mail for local delivery.
+// It doesn't support authentication or tls and is meant to listen on
+// localhost only.
+type smtpServer struct {
+	hostname string
+
+	// acceptRcpt checks whether mail for the recipient address can be
+	// delivered.
+	acceptRcpt func(rcpt string) error
+
+	// deliver delivers a received mail.
+	deliver func(env *smtpEnvelope) error
+}
+
+// serve accepts connections until the listener is closed.
+func (s *smtpServer) serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := s.handle(conn); err != nil && err != io.EOF {
+				fmt.Printf("Smtp session failed: %v\n", err)
+			}
+		}()
+	}
+}
+
+// handle runs an smtp session.
+func (s *smtpServer) handle(conn net.Conn) error {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	reply := func(code int, msg string) error {
+		return tp.PrintfLine("%d %s", code, msg)
+	}
+
+	if err := reply(220, s.hostname+" ESMTP whatsat"); err != nil {
+		return err
+	}
+
+	// env is the mail of the current transaction. It is nil until a
+	// MAIL command starts a transaction.
+	var env *smtpEnvelope
+	for {
+		deadline := time.Now().Add(smtpTimeout)
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+
+		line, err := tp.ReadLine()
+		if err != nil {
+			return err
+		}
+
+		verb, arg := line, ""
+		if i := strings.Index(line, " "); i >= 0 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			err = reply(250, s.hostname)
+
+		case "EHLO":
+			err = tp.PrintfLine("250-%s\r\n250-SIZE %d\r\n"+
+				"250 8BITMIME", s.hostname, smtpMaxSize)
+
+		case "MAIL":
+			from, ok := smtpPath(arg, "FROM:")
+			if !ok {
+				err = reply(501, "syntax: MAIL FROM:<address>")
+				break
+			}
+			env = &smtpEnvelope{from: from}
+			err = reply(250, "ok")
+
+		case "RCPT":
+			to, ok := smtpPath(arg, "TO:")
+			switch {
+			case !ok:
+				err = reply(501, "syntax: RCPT TO:<address>")
+
+			case env == nil:
+				err = reply(503, "need MAIL first")
+
+			default:
+				if rcptErr := s.acceptRcpt(to); rcptErr != nil {
+					err = reply(550, rcptErr.Error())
+					break
+				}
+				env.to = append(env.to, to)
+				err = reply(250, "ok")
+			}
+
+		case "DATA":
+			if env == nil || len(env.to) == 0 {
+				err = reply(503, "need RCPT first")
+				break
+			}
+			err = reply(354, "end data with <CR><LF>.<CR><LF>")
+			if err != nil {
+				break
+			}
+
+			err = s.receiveData(tp, env)
+			env = nil
+
+		case "RSET":
+			env = nil
+			err = reply(250, "ok")
+
+		case "NOOP":
+			err = reply(250, "ok")
+
+		case "QUIT":
+			_ = reply(221, "bye")
+			return nil
+
+		default:
+			err = reply(502, "command not implemented")
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// receiveData reads the message data of the envelope and delivers it.
+func (s *smtpServer) receiveData(tp *textproto.Conn,
+	env *smtpEnvelope) error {
+
+	data := tp.DotReader()
+
+	var err error
+	env.data, err = ioutil.ReadAll(io.LimitReader(data, smtpMaxSize+1))
+	if err != nil {
+		return err
+	}
+
+	if len(env.data) > smtpMaxSize {
+		// Drain the rest of the message.
+		if _, err := io.Copy(ioutil.Discard, data); err != nil {
+			return err
+		}
+
+		return tp.PrintfLine("552 message too large")
+	}
+
+	if err := s.deliver(env); err != nil {
+		return tp.PrintfLine("554 %s", err)
+	}
+
+	return tp.PrintfLine("250 ok")
+}
+
+// smtpPath extracts the address from a MAIL or RCPT argument like
+// FROM:<user@host> SIZE=123.
+func smtpPath(arg, prefix string) (string, bool) {
+	if !strings.HasPrefix(strings.ToUpper(arg), prefix) {
+		return "", false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+
+	start := strings.Index(arg, "<")
+	end := strings.Index(arg, ">")
+	if start != 0 || end < start {
+		return "", false
+	}
+
+	return arg[start+1 : end], true
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSMTPSession runs an smtp session over a pipe and returns the client side
+// and the delivered mails. The recipients must end in @whatsat.local. Mails to
+// fail@whatsat.local can't be delivered.
+func testSMTPSession(t *testing.T) (*textproto.Conn, chan *smtpEnvelope,
+	func()) {
+
+	delivered := make(chan *smtpEnvelope, 10)
+	server := &smtpServer{
+		hostname: "test",
+		acceptRcpt: func(rcpt string) error {
+			if !strings.HasSuffix(rcpt, "@whatsat.local") {
+				return fmt.Errorf("unknown recipient")
+			}
+			return nil
+		},
+		deliver: func(env *smtpEnvelope) error {
+			for _, to := range env.to {
+				if to == "fail@whatsat.local" {
+					return fmt.Errorf("delivery failed")
+				}
+			}
+			delivered <- env
+			return nil
+		},
+	}
+
+	serverConn, clientConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- server.handle(serverConn)
+	}()
+
+	tp := textproto.NewConn(clientConn)
+	if _, _, err := tp.ReadResponse(220); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanUp := func() {
+		tp.Close()
+		select {
+		case <-done:
+		case <-time.After(testTimeout):
+			t.Fatal("session didn't end")
+		}
+	}
+
+	return tp, delivered, cleanUp
+}
+
+// smtpCmd sends a command and checks the response code.
+func smtpCmd(t *testing.T, tp *textproto.Conn, code int, format string,
+	args ...interface{}) string {
+
+	t.Helper()
+
+	id, err := tp.Cmd(format, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp.StartResponse(id)
+	defer tp.EndResponse(id)
+
+	_, msg, err := tp.ReadResponse(code)
+	if err != nil {
+		t.Fatalf("%v: %v", fmt.Sprintf(format, args...), err)
+	}
+
+	return msg
+}
+
+// smtpData sends the data of a mail and checks the response code.
+func smtpData(t *testing.T, tp *textproto.Conn, code int, data string) {
+	t.Helper()
+
+	smtpCmd(t, tp, 354, "DATA")
+
+	w := tp.DotWriter()
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := tp.ReadResponse(code); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSMTPSession(t *testing.T) {
+	tp, delivered, cleanUp := testSMTPSession(t)
+	defer cleanUp()
+
+	msg := smtpCmd(t, tp, 250, "EHLO client")
+	if !strings.Contains(msg, fmt.Sprintf("SIZE %v", smtpMaxSize)) {
+		t.Fatalf("size not announced: %v", msg)
+	}
+
+	// Commands out of order are rejected.
+	smtpCmd(t, tp, 503, "RCPT TO:<bob@whatsat.local>")
+	smtpCmd(t, tp, 501, "MAIL alice@example.com")
+	smtpCmd(t, tp, 250, "MAIL FROM:<alice@example.com> SIZE=100")
+	smtpCmd(t, tp, 503, "DATA")
+
+	// Unknown recipients are rejected, the others are kept.
+	smtpCmd(t, tp, 550, "RCPT TO:<bob@example.com>")
+	smtpCmd(t, tp, 250, "rcpt to:<bob@whatsat.local>")
+	smtpCmd(t, tp, 250, "RCPT TO:<carol@whatsat.local>")
+	smtpData(t, tp, 250, "Subject: hi\r\n\r\nhello\r\n.dot\r\n")
+
+	select {
+	case env := <-delivered:
+		expected := &smtpEnvelope{
+			from: "alice@example.com",
+			to: []string{
+				"bob@whatsat.local", "carol@whatsat.local",
+			},
+			data: []byte("Subject: hi\n\nhello\n.dot\n"),
+		}
+		if !reflect.DeepEqual(env, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, env)
+		}
+
+	case <-time.After(testTimeout):
+		t.Fatal("mail not delivered")
+	}
+
+	// The transaction ends with the data.
+	smtpCmd(t, tp, 503, "RCPT TO:<bob@whatsat.local>")
+
+	// Delivery errors are reported.
+	smtpCmd(t, tp, 250, "MAIL FROM:<alice@example.com>")
+	smtpCmd(t, tp, 250, "RCPT TO:<fail@whatsat.local>")
+	smtpData(t, tp, 554, "\r\nhello\r\n")
+
+	// A reset transaction can't be completed.
+	smtpCmd(t, tp, 250, "MAIL FROM:<alice@example.com>")
+	smtpCmd(t, tp, 250, "RCPT TO:<bob@whatsat.local>")
+	smtpCmd(t, tp, 250, "RSET")
+	smtpCmd(t, tp, 503, "DATA")
+
+	smtpCmd(t, tp, 250, "NOOP")
+	smtpCmd(t, tp, 502, "VRFY bob")
+	smtpCmd(t, tp, 221, "QUIT")
+
+	select {
+	case env := <-delivered:
+		t.Fatalf("unexpected delivery %+v", env)
+	default:
+	}
+}
+
+func TestSMTPSizeLimit(t *testing.T) {
+	tp, delivered, cleanUp := testSMTPSession(t)
+	defer cleanUp()
+
+	smtpCmd(t, tp, 250, "HELO client")
+	smtpCmd(t, tp, 250, "MAIL FROM:<alice@example.com>")
+	smtpCmd(t, tp, 250, "RCPT TO:<bob@whatsat.local>")
+
+	// The line endings are counted as a single byte.
+	line := strings.Repeat("x", 999) + "\r\n"
+	data := "\r\n" + strings.Repeat(line, smtpMaxSize/1000+1)
+	smtpData(t, tp, 552, data)
+
+	// The session continues after the rejected mail.
+	smtpCmd(t, tp, 250, "MAIL FROM:<alice@example.com>")
+	smtpCmd(t, tp, 250, "RCPT TO:<bob@whatsat.local>")
+	smtpData(t, tp, 250, "\r\nshort\r\n")
+
+	select {
+	case env := <-delivered:
+		if string(env.data) != "\nshort\n" {
+			t.Fatalf("unexpected mail %q", env.data)
+		}
+
+	case <-time.After(testTimeout):
+		t.Fatal("mail not delivered")
+	}
+}
+
+func TestSMTPPath(t *testing.T) {
+	tests := []struct {
+		arg      string
+		prefix   string
+		expected string
+		ok       bool
+	}{
+		{"FROM:<a@b>", "FROM:", "a@b", true},
+		{"from: <a@b> SIZE=10", "FROM:", "a@b", true},
+		{"FROM:<>", "FROM:", "", true},
+		{"TO:<a@b>", "FROM:", "", false},
+		{"FROM:a@b", "FROM:", "", false},
+		{"FROM:<a@b", "FROM:", "", false},
+	}
+
+	for _, test := range tests {
+		path, ok := smtpPath(test.arg, test.prefix)
+		if path != test.expected || ok != test.ok {
+			t.Errorf("%v: expected %q %v, got %q %v", test.arg,
+				test.expected, test.ok, path, ok)
+		}
+	}
+}
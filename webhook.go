@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+const (
+	// webhookSignatureHeader carries the hex encoded HMAC-SHA256 of the
+	// request body, keyed with the webhook secret.
+	webhookSignatureHeader = "X-Whatsat-Signature"
+
+	// webhookAttempts is the number of times a payload is posted before
+	// giving up.
+	webhookAttempts = 5
+
+	webhookTimeout = 10 * time.Second
+
+	// webhookQueueSize is the number of messages that can wait for
+	// delivery to a single webhook. Messages are dropped when the queue is
+	// full, so that a slow or unreachable webhook can't hold up the daemon.
+	webhookQueueSize = 100
+)
+
+// webhookPayload is posted to the webhooks for every incoming message.
+type webhookPayload struct {
+	ID        uint64    `json:"id"`
+	Sender    string    `json:"sender"`
+	Alias     string    `json:"alias"`
+	Text      string    `json:"text"`
+	Timestamp time.Time `json:"timestamp"`
+	AmtMsat   int64     `json:"amt_msat"`
+
+	// Verified is always true, because messages with an invalid
+	// signature are dropped before they reach the webhooks. It is
+	// included so that receivers don't need to know that.
+	Verified bool `json:"verified"`
+}
+
+// webhookDelivery is a payload that waits for delivery to a webhook.
+type webhookDelivery struct {
+	id   uint64
+	body []byte
+}
+
+// webhookDispatcher posts incoming messages to webhooks. Every webhook has its
+// own queue and worker, so deliveries to one webhook happen in order and
+// don't wait for the others.
+type webhookDispatcher struct {
+	urls   []string
+	secret []byte
+
+	queues map[string]chan *webhookDelivery
+
+	// senders restricts the messages that are posted to these senders.
+	// All messages are posted if it is empty.
+	senders map[route.Vertex]struct{}
+
+	client *http.Client
+
+	// retryDelay is the delay before the first retry. It doubles with
+	// every attempt.
+	retryDelay time.Duration
+}
+
+func newWebhookDispatcher(urls []string, secret string,
+	senders []route.Vertex) *webhookDispatcher {
+
+	d := &webhookDispatcher{
+		urls:    urls,
+		secret:  []byte(secret),
+		queues:  make(map[string]chan *webhookDelivery),
+		senders: make(map[route.Vertex]struct{}),
+		client: &http.Client{
+			Timeout: webhookTimeout,
+		},
+		retryDelay: time.Second,
+	}
+	for _, url := range urls {
+		d.queues[url] = make(chan *webhookDelivery, webhookQueueSize)
+	}
+	for _, sender := range senders {
+		d.senders[sender] = struct{}{}
+	}
+
+	return d
+}
+
+// start subscribes to the store and posts incoming messages in the background
+// until the quit channel is closed. If the subscription falls behind, the
+// missed messages are posted from the history after subscribing again.
+func (d *webhookDispatcher) start(store *messageStore, quit <-chan struct{}) {
+	for url, queue := range d.queues {
+		go d.worker(url, queue, quit)
+	}
+
+	events, cancel := store.subscribe()
+
+	go func() {
+		defer func() {
+			cancel()
+		}()
+
+		// lastID is the id of the last message that was posted.
+		// Message ids increase, so it marks where to catch up from.
+		var lastID uint64
+		post := func(msg *storedMessage) {
+			if msg.ID <= lastID {
+				return
+			}
+			lastID = msg.ID
+
+			d.dispatch(msg)
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					log.Printf("Webhooks fell behind, " +
+						"posting missed messages")
+
+					events, cancel = store.subscribe()
+					for _, msg := range store.history(nil) {
+						if !msg.Outgoing {
+							post(msg)
+						}
+					}
+					continue
+				}
+
+				if event.Type != eventReceived {
+					continue
+				}
+
+				post(event.Message)
+
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// dispatch queues the message for all webhooks, if it passes the sender
+// filter.
+func (d *webhookDispatcher) dispatch(msg *storedMessage) {
+	sender, err := route.NewVertexFromStr(msg.Peer)
+	if err != nil {
+		return
+	}
+
+	if len(d.senders) > 0 {
+		if _, ok := d.senders[sender]; !ok {
+			return
+		}
+	}
+
+	body, err := json.Marshal(&webhookPayload{
+		ID:        msg.ID,
+		Sender:    msg.Peer,
+		Alias:     msg.Alias,
+		Text:      msg.Text,
+		Timestamp: msg.Timestamp,
+		AmtMsat:   msg.AmtMsat,
+		Verified:  true,
+	})
+	if err != nil {
+		log.Printf("Cannot encode webhook payload: %v", err)
+		return
+	}
+
+	for _, url := range d.urls {
+		select {
+		case d.queues[url] <- &webhookDelivery{id: msg.ID, body: body}:
+		default:
+			log.Printf("Webhook %v queue full, dropping message %v",
+				url, msg.ID)
+		}
+	}
+}
+
+// worker delivers the queued payloads to the url one at a time until the
+// quit channel is closed.
+func (d *webhookDispatcher) worker(url string, queue <-chan *webhookDelivery,
+	quit <-chan struct{}) {
+
+	for {
+		select {
+		case delivery := <-queue:
+			err := d.deliver(url, delivery.body, quit)
+			if err != nil {
+				log.Printf("Webhook %v failed for message "+
+					"%v: %v", url, delivery.id, err)
+			}
+
+		case <-quit:
+			return
+		}
+	}
+}
+
+// deliver posts the body to the url. Network errors and server errors are
+// retried with an exponential backoff, until the quit channel is closed.
+func (d *webhookDispatcher) deliver(url string, body []byte,
+	quit <-chan struct{}) error {
+
+	delay := d.retryDelay
+
+	var err error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		var retry bool
+		retry, err = d.post(url, body)
+		if err == nil || !retry {
+			return err
+		}
+
+		if attempt < webhookAttempts {
+			select {
+			case <-time.After(delay):
+			case <-quit:
+				return fmt.Errorf("shutting down: %v", err)
+			}
+			delay *= 2
+		}
+	}
+
+	return fmt.Errorf("giving up after %v attempts: %v", webhookAttempts,
+		err)
+}
+
+// post makes a single delivery attempt. It returns whether a failed attempt
+// is worth retrying.
+func (d *webhookDispatcher) post(url string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookSignatureHeader, d.sign(body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+
+	case resp.StatusCode >= 500,
+		resp.StatusCode == http.StatusTooManyRequests:
+
+		return true, fmt.Errorf("status %v", resp.Status)
+
+	default:
+		return false, fmt.Errorf("status %v", resp.Status)
+	}
+}
+
+// sign returns the signature header value for the body.
+func (d *webhookDispatcher) sign(body []byte) string {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
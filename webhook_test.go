@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/routing/route"
+)
+
+// webhookRequest is a request received by the test webhook.
+type webhookRequest struct {
+	signature string
+	body      []byte
+}
+
+func TestWebhookSignature(t *testing.T) {
+	requests := make(chan *webhookRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			requests <- &webhookRequest{
+				signature: r.Header.Get(webhookSignatureHeader),
+				body:      body,
+			}
+		},
+	))
+	defer server.Close()
+
+	peer := testPeer(t)
+	d := newWebhookDispatcher(
+		[]string{server.URL}, "secret", []route.Vertex{peer},
+	)
+
+	store := newMessageStore(&chatEngine{
+		runningBalance: make(map[route.Vertex]int64),
+	}, nil)
+
+	quit := make(chan struct{})
+	defer close(quit)
+	d.start(store, quit)
+
+	store.mtx.Lock()
+	// Outgoing messages and messages of other senders aren't posted.
+	store.add(eventSent, &storedMessage{
+		Peer:     peer.String(),
+		Text:     "sent",
+		Outgoing: true,
+	})
+	store.add(eventReceived, &storedMessage{
+		Peer: testSelfKey,
+		Text: "other",
+	})
+	store.add(eventReceived, &storedMessage{
+		Peer:    peer.String(),
+		Text:    "hi",
+		AmtMsat: 1000,
+	})
+	store.mtx.Unlock()
+
+	var req *webhookRequest
+	select {
+	case req = <-requests:
+	case <-time.After(testTimeout):
+		t.Fatal("no webhook request")
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(req.body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if req.signature != expected {
+		t.Fatalf("expected signature %v, got %v", expected,
+			req.signature)
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID != 3 || payload.Sender != peer.String() ||
+		payload.Text != "hi" || payload.AmtMsat != 1000 ||
+		!payload.Verified {
+
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+
+	select {
+	case req = <-requests:
+		t.Fatalf("unexpected request %s", req.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		calls    int32
+		success  bool
+	}{
+		{
+			name:     "success",
+			statuses: []int{http.StatusOK},
+			calls:    1,
+			success:  true,
+		},
+		{
+			name: "server errors",
+			statuses: []int{
+				http.StatusInternalServerError,
+				http.StatusTooManyRequests,
+				http.StatusNoContent,
+			},
+			calls:   3,
+			success: true,
+		},
+		{
+			name:     "client error",
+			statuses: []int{http.StatusBadRequest},
+			calls:    1,
+		},
+		{
+			name:     "give up",
+			statuses: []int{http.StatusBadGateway},
+			calls:    webhookAttempts,
+		},
+	}
+
+	for _, test := range tests {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&calls, 1))
+				if n > len(test.statuses) {
+					n = len(test.statuses)
+				}
+				w.WriteHeader(test.statuses[n-1])
+			},
+		))
+
+		d := newWebhookDispatcher([]string{server.URL}, "secret", nil)
+		d.retryDelay = time.Millisecond
+
+		err := d.deliver(server.URL, []byte("{}"), nil)
+		server.Close()
+
+		if (err == nil) != test.success {
+			t.Fatalf("%v: unexpected result %v", test.name, err)
+		}
+		if calls != test.calls {
+			t.Fatalf("%v: expected %v calls, got %v", test.name,
+				test.calls, calls)
+		}
+	}
+}
+
+func TestWebhookRetryQuit(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	))
+	defer server.Close()
+
+	d := newWebhookDispatcher([]string{server.URL}, "secret", nil)
+	d.retryDelay = time.Hour
+
+	// Shutting down doesn't wait for the next attempt.
+	quit := make(chan struct{})
+	close(quit)
+	if err := d.deliver(server.URL, []byte("{}"), quit); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %v", calls)
+	}
+}
+
+func TestWebhookQueueLimit(t *testing.T) {
+	urls := []string{"http://a.invalid", "http://b.invalid"}
+	d := newWebhookDispatcher(urls, "secret", nil)
+
+	// Without workers nothing is taken from the queues, so messages beyond
+	// the queue size are dropped instead of piling up.
+	peer := testPeer(t)
+	for i := 0; i < webhookQueueSize+10; i++ {
+		d.dispatch(&storedMessage{
+			ID:   uint64(i + 1),
+			Peer: peer.String(),
+		})
+	}
+
+	for _, url := range urls {
+		queue := d.queues[url]
+		if len(queue) != webhookQueueSize {
+			t.Fatalf("expected %v queued messages, got %v",
+				webhookQueueSize, len(queue))
+		}
+		if first := <-queue; first.id != 1 {
+			t.Fatalf("expected message 1 first, got %v", first.id)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+#!/bin/sh
+
+# Generate the protos with protoc-gen-go v1.3.2 and the grpc plugin.
+protoc -I. whatsat.proto --go_out=plugins=grpc,paths=source_relative:.